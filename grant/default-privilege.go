@@ -0,0 +1,265 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package grant
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+	"github.com/jiapeish/pgdiff/pkg"
+)
+
+var (
+	defaultPrivilegeSqlTemplate = initDefaultPrivilegeSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// Default privileges that are not limited to one schema (schema_name is null) are only
+// compared when all schemas are being compared.
+func initDefaultPrivilegeSqlTemplate() *template.Template {
+	sql := `
+SELECT pg_catalog.pg_get_userbyid(d.defaclrole) AS role_name
+  , n.nspname AS schema_name
+  , CASE d.defaclobjtype
+    WHEN 'r' THEN 'TABLES'
+    WHEN 'S' THEN 'SEQUENCES'
+    WHEN 'f' THEN 'FUNCTIONS'
+    WHEN 'T' THEN 'TYPES'
+    WHEN 'n' THEN 'SCHEMAS'
+    END AS object_type
+  , d.defaclobjtype AS acl_type
+  , pg_catalog.pg_get_userbyid(d.defaclrole) || '.' || {{ if eq $.DbSchema "*" }}COALESCE(n.nspname, '') || '.' || {{ end }}d.defaclobjtype AS compare_name
+  , unnest(d.defaclacl) AS default_acl
+FROM pg_catalog.pg_default_acl d
+LEFT JOIN pg_catalog.pg_namespace n ON (n.oid = d.defaclnamespace)
+WHERE true
+{{ if eq $.DbSchema "*" }}
+AND (n.nspname IS NULL OR (n.nspname NOT LIKE 'pg_%' AND n.nspname <> 'information_schema'))
+{{ else }}
+AND n.nspname = '{{ $.DbSchema }}'
+{{ end }};
+`
+
+	t := template.New("DefaultPrivilegeSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+var (
+	builtInDefaultPrivilegeSqlTemplate = initBuiltInDefaultPrivilegeSqlTemplate()
+)
+
+// Initializes the Sql template that selects the built-in default privileges of a role for one
+// kind of object, in the same form as the default privileges above.
+//
+// A default privilege that is not limited to a schema replaces the built-in defaults rather than
+// adding to them, so a database without one has to be compared as if it had the built-in ones.
+func initBuiltInDefaultPrivilegeSqlTemplate() *template.Template {
+	sql := `
+SELECT r.rolname AS role_name
+  , NULL AS schema_name
+  , '{{ $.object_type }}' AS object_type
+  , '{{ $.acl_type }}' AS acl_type
+  , '{{ $.compare_name }}' AS compare_name
+  , unnest(pg_catalog.acldefault('{{ $.acl_type }}', r.oid)) AS default_acl
+FROM pg_catalog.pg_roles r
+WHERE r.rolname = '{{ $.role_name }}';
+`
+
+	t := template.New("BuiltInDefaultPrivilegeSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// DefaultPrivilegeRows definition
+// ==================================
+
+// DefaultPrivilegeRows is a sortable slice of string maps
+type DefaultPrivilegeRows []map[string]string
+
+func (slice DefaultPrivilegeRows) Len() int {
+	return len(slice)
+}
+
+func (slice DefaultPrivilegeRows) Less(i, j int) bool {
+	if slice[i]["compare_name"] != slice[j]["compare_name"] {
+		return slice[i]["compare_name"] < slice[j]["compare_name"]
+	}
+
+	// Compare the grantee and grantor parts of the ACL
+	return compareAcls(slice[i]["default_acl"], slice[i]["role_name"], slice[j]["default_acl"], slice[j]["role_name"]) < 0
+}
+
+func (slice DefaultPrivilegeRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ==================================
+// DefaultPrivilegeSchema definition
+// (implements Schema -- defined in pgdiff.go)
+// ==================================
+
+// DefaultPrivilegeSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+type DefaultPrivilegeSchema struct {
+	rows   DefaultPrivilegeRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *DefaultPrivilegeSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *DefaultPrivilegeSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *DefaultPrivilegeSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*DefaultPrivilegeSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare needs a DefaultPrivilegeSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	if val != 0 {
+		return val
+	}
+
+	val = compareAcls(c.get("default_acl"), c.get("role_name"), c2.get("default_acl"), c2.get("role_name"))
+	return val
+}
+
+// aclTarget returns what it takes to write ALTER DEFAULT PRIVILEGES statements for the current row
+// (in the given schema, which is ignored when the row is not limited to a schema).  The grantor is
+// always the role the defaults belong to, so GRANTED BY is never needed.
+func (c *DefaultPrivilegeSchema) aclTarget(schema string) aclTarget {
+	prefix := fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s ", quoteRole(c.get("role_name")))
+	if c.get("schema_name") != "null" {
+		prefix = fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s ", quoteRole(c.get("role_name")), schema)
+	}
+	return aclTarget{prefix: prefix, on: c.get("object_type")}
+}
+
+// Add prints SQL to add the default privileges
+func (c *DefaultPrivilegeSchema) Add() {
+	schema := pkg.DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+
+	c.aclTarget(schema).add(parseAclItem(c.get("default_acl")))
+}
+
+// Drop prints SQL to drop the default privileges
+func (c *DefaultPrivilegeSchema) Drop() {
+	c.aclTarget(c.get("schema_name")).drop(parseAclItem(c.get("default_acl")))
+}
+
+// Change handles the case where the role, schema, object type, grantee and grantor match, but the privileges do not
+func (c *DefaultPrivilegeSchema) Change(obj interface{}) {
+	c2, ok := obj.(*DefaultPrivilegeSchema)
+	if !ok {
+		fmt.Println("-- Error!!!, Change needs a DefaultPrivilegeSchema instance", c2)
+	}
+
+	item1 := parseAclItem(c.get("default_acl"))
+	item2 := parseAclItem(c2.get("default_acl"))
+	c2.aclTarget(c2.get("schema_name")).change(item1, item2)
+}
+
+// ==================================
+// Functions
+// ==================================
+
+// builtInDefaultPrivileges returns the built-in default privileges (selected through conn) for each
+// default privilege in rows that is not limited to a schema and that otherRows does not have
+func builtInDefaultPrivileges(conn *sql.DB, rows DefaultPrivilegeRows, otherRows DefaultPrivilegeRows) DefaultPrivilegeRows {
+	otherCompareNames := make(map[string]bool)
+	for _, row := range otherRows {
+		otherCompareNames[row["compare_name"]] = true
+	}
+
+	builtIns := make(DefaultPrivilegeRows, 0)
+	added := make(map[string]bool)
+	for _, row := range rows {
+		if row["schema_name"] != "null" || otherCompareNames[row["compare_name"]] || added[row["compare_name"]] {
+			continue
+		}
+		added[row["compare_name"]] = true
+
+		params := map[string]string{}
+		for _, key := range []string{"role_name", "object_type", "acl_type", "compare_name"} {
+			params[key] = strings.Replace(row[key], "'", "''", -1)
+		}
+		buf := new(bytes.Buffer)
+		builtInDefaultPrivilegeSqlTemplate.Execute(buf, params)
+
+		rowChan, _ := pgutil.QueryStrings(conn, buf.String())
+		for builtIn := range rowChan {
+			builtIns = append(builtIns, builtIn)
+		}
+	}
+	return builtIns
+}
+
+// CompareDefaultPrivileges outputs SQL to make the default privileges match between DBs or schemas
+func CompareDefaultPrivileges(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	defaultPrivilegeSqlTemplate.Execute(buf1, pkg.DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	defaultPrivilegeSqlTemplate.Execute(buf2, pkg.DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(DefaultPrivilegeRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+
+	rows2 := make(DefaultPrivilegeRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+
+	// Compare a missing default privilege that is not limited to a schema with the built-in one it replaces
+	if pkg.DbInfo1.DbSchema == "*" && pkg.DbInfo2.DbSchema == "*" {
+		builtIns1 := builtInDefaultPrivileges(conn2, rows2, rows1)
+		builtIns2 := builtInDefaultPrivileges(conn1, rows1, rows2)
+		rows1 = append(rows1, builtIns1...)
+		rows2 = append(rows2, builtIns2...)
+	}
+	sort.Sort(rows1)
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 pkg.Schema = &DefaultPrivilegeSchema{rows: rows1, rowNum: -1}
+	var schema2 pkg.Schema = &DefaultPrivilegeSchema{rows: rows2, rowNum: -1}
+
+	pkg.DoDiff(schema1, schema2)
+}
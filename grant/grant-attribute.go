@@ -11,7 +11,6 @@ import (
 	"database/sql"
 	"fmt"
 	"sort"
-	"strings"
 	"text/template"
 
 	"github.com/jiapeish/pgdiff/pgutil"
@@ -36,6 +35,7 @@ SELECT
     END as type
   , c.relname AS relationship_name
   , a.attname AS attribute_name
+  , pg_catalog.pg_get_userbyid(c.relowner) AS owner
   , a.attacl  AS attribute_acl
 FROM pg_catalog.pg_class c
 LEFT JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
@@ -44,6 +44,7 @@ INNER JOIN (SELECT attname, unnest(attacl) AS attacl, attrelid
            WHERE NOT attisdropped AND attacl IS NOT NULL)
       AS a ON (a.attrelid = c.oid)
 WHERE c.relkind IN ('r', 'v', 'f')
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
 --AND pg_catalog.pg_table_is_visible(c.oid)
 {{ if eq $.DbSchema "*" }}
 AND n.nspname NOT LIKE 'pg_%'
@@ -74,16 +75,8 @@ func (slice GrantAttributeRows) Less(i, j int) bool {
 		return slice[i]["compare_name"] < slice[j]["compare_name"]
 	}
 
-	// Only compare the role part of the ACL
-	// Not yet sure if this is absolutely necessary
-	// (or if we could just compare the entire ACL string)
-	role1, _ := parseAcl(slice[i]["attribute_acl"])
-	role2, _ := parseAcl(slice[j]["attribute_acl"])
-	if role1 != role2 {
-		return role1 < role2
-	}
-
-	return false
+	// Compare the grantee and grantor parts of the ACL
+	return compareAcls(slice[i]["attribute_acl"], slice[i]["owner"], slice[j]["attribute_acl"], slice[j]["owner"]) < 0
 }
 
 func (slice GrantAttributeRows) Swap(i, j int) {
@@ -142,12 +135,20 @@ func (c *GrantAttributeSchema) Compare(obj interface{}) int {
 		return val
 	}
 
-	role1, _ := parseAcl(c.get("attribute_acl"))
-	role2, _ := parseAcl(c2.get("attribute_acl"))
-	val = pgutil.CompareStrings(role1, role2)
+	val = compareAcls(c.get("attribute_acl"), c.get("owner"), c2.get("attribute_acl"), c2.get("owner"))
 	return val
 }
 
+// aclTarget returns what it takes to write GRANT and REVOKE statements for the current column
+// (in the given schema) and ACL item
+func (c *GrantAttributeSchema) aclTarget(schema string, item aclItem) aclTarget {
+	return aclTarget{
+		privilegeSuffix: fmt.Sprintf(" (%s)", c.get("attribute_name")),
+		on:              fmt.Sprintf("TABLE %s.%s", schema, c.get("relationship_name")),
+		grantedBy:       grantorUnlessOwner(item, c.get("owner")),
+	}
+}
+
 // Add prints SQL to add the grant
 func (c *GrantAttributeSchema) Add() {
 	schema := pkg.DbInfo2.DbSchema
@@ -155,53 +156,26 @@ func (c *GrantAttributeSchema) Add() {
 		schema = c.get("schema_name")
 	}
 
-	role, grants := parseGrants(c.get("attribute_acl"))
-	fmt.Printf("GRANT %s (%s) ON %s.%s TO %s; -- Add\n", strings.Join(grants, ", "), c.get("attribute_name"), schema, c.get("relationship_name"), role)
+	item := parseAclItem(c.get("attribute_acl"))
+	c.aclTarget(schema, item).add(item)
 }
 
 // Drop prints SQL to drop the grant
 func (c *GrantAttributeSchema) Drop() {
-	role, grants := parseGrants(c.get("attribute_acl"))
-	fmt.Printf("REVOKE %s (%s) ON %s.%s FROM %s; -- Drop\n", strings.Join(grants, ", "), c.get("attribute_name"), c.get("schema_name"), c.get("relationship_name"), role)
+	item := parseAclItem(c.get("attribute_acl"))
+	c.aclTarget(c.get("schema_name"), item).drop(item)
 }
 
-// Change handles the case where the relationship and column match, but the grant does not
+// Change handles the case where the relationship, column, grantee and grantor match, but the grant does not
 func (c *GrantAttributeSchema) Change(obj interface{}) {
 	c2, ok := obj.(*GrantAttributeSchema)
 	if !ok {
 		fmt.Println("-- Error!!!, Change needs a GrantAttributeSchema instance", c2)
 	}
 
-	role, grants1 := parseGrants(c.get("attribute_acl"))
-	_, grants2 := parseGrants(c2.get("attribute_acl"))
-
-	// Find grants in the first db that are not in the second
-	// (for this relationship and owner)
-	var grantList []string
-	for _, g := range grants1 {
-		if !pgutil.ContainsString(grants2, g) {
-			grantList = append(grantList, g)
-		}
-	}
-	if len(grantList) > 0 {
-		fmt.Printf("GRANT %s (%s) ON %s.%s TO %s; -- Change\n", strings.Join(grantList, ", "),
-			c.get("attribute_name"), c2.get("schema_name"), c.get("relationship_name"), role)
-	}
-
-	// Find grants in the second db that are not in the first
-	// (for this relationship and owner)
-	var revokeList []string
-	for _, g := range grants2 {
-		if !pgutil.ContainsString(grants1, g) {
-			revokeList = append(revokeList, g)
-		}
-	}
-	if len(revokeList) > 0 {
-		fmt.Printf("REVOKE %s (%s) ON %s.%s FROM %s; -- Change\n", strings.Join(revokeList, ", "), c.get("attribute_name"), c2.get("schema_name"), c.get("relationship_name"), role)
-	}
-
-	//fmt.Printf("--1 rel:%s, relAcl:%s, col:%s, colAcl:%s\n", c.get("attribute_name"), c.get("attribute_acl"), c.get("attribute_name"), c.get("attribute_acl"))
-	//fmt.Printf("--2 rel:%s, relAcl:%s, col:%s, colAcl:%s\n", c2.get("attribute_name"), c2.get("attribute_acl"), c2.get("attribute_name"), c2.get("attribute_acl"))
+	item1 := parseAclItem(c.get("attribute_acl"))
+	item2 := parseAclItem(c2.get("attribute_acl"))
+	c2.aclTarget(c2.get("schema_name"), item2).change(item1, item2)
 }
 
 // ==================================
@@ -0,0 +1,289 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package grant
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+	"github.com/jiapeish/pgdiff/pkg"
+)
+
+var (
+	grantObjectSqlTemplate = initGrantObjectSqlTemplate()
+)
+
+// Initializes the Sql template for grants on schemas and the objects in them (other than relationships)
+//
+// Objects without an ACL get their default privileges from acldefault() so they compare
+// correctly against objects with explicit grants.
+func initGrantObjectSqlTemplate() *template.Template {
+	sql := `
+SELECT n.nspname AS schema_name
+  , {{ if eq $.DbSchema "*" }}n.nspname::text || '.' || {{ end }}'SCHEMA' AS compare_name
+  , 'SCHEMA' AS type
+  , n.nspname::text AS object_name
+  , pg_catalog.pg_get_userbyid(n.nspowner) AS owner
+  , unnest(COALESCE(n.nspacl, pg_catalog.acldefault('n', n.nspowner))) AS object_acl
+FROM pg_catalog.pg_namespace n
+WHERE true
+{{ if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{ else }}
+AND n.nspname = '{{ $.DbSchema }}'
+{{ end }}
+UNION ALL
+SELECT n.nspname AS schema_name
+  , {{ if eq $.DbSchema "*" }}n.nspname::text || '.' || {{ end }}CASE p.prokind WHEN 'p' THEN 'PROCEDURE' ELSE 'FUNCTION' END
+    || '.' || p.proname::text || '(' || pg_catalog.oidvectortypes(p.proargtypes) || ')' AS compare_name
+  , CASE p.prokind WHEN 'p' THEN 'PROCEDURE' ELSE 'FUNCTION' END AS type
+  , p.proname::text || '(' || pg_catalog.pg_get_function_identity_arguments(p.oid) || ')' AS object_name
+  , pg_catalog.pg_get_userbyid(p.proowner) AS owner
+  , unnest(COALESCE(p.proacl, pg_catalog.acldefault('f', p.proowner))) AS object_acl
+FROM pg_catalog.pg_proc p
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = p.pronamespace)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')
+{{ if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{ else }}
+AND n.nspname = '{{ $.DbSchema }}'
+{{ end }}
+UNION ALL
+SELECT n.nspname AS schema_name
+  , {{ if eq $.DbSchema "*" }}n.nspname::text || '.' || {{ end }}'TYPE.' || t.typname::text AS compare_name
+  , CASE t.typtype WHEN 'd' THEN 'DOMAIN' ELSE 'TYPE' END AS type
+  , t.typname::text AS object_name
+  , pg_catalog.pg_get_userbyid(t.typowner) AS owner
+  , unnest(COALESCE(t.typacl, pg_catalog.acldefault('T', t.typowner))) AS object_acl
+FROM pg_catalog.pg_type t
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = t.typnamespace)
+WHERE (t.typrelid = 0 OR (SELECT c.relkind FROM pg_catalog.pg_class c WHERE c.oid = t.typrelid) = 'c')
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_type el WHERE el.oid = t.typelem AND el.typarray = t.oid)
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_type'::regclass AND d.objid = t.oid AND d.deptype = 'e')
+{{ if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{ else }}
+AND n.nspname = '{{ $.DbSchema }}'
+{{ end }};
+`
+
+	t := template.New("GrantObjectSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// grantGlobalObjectSql selects the grants on objects that belong to the database rather than to a schema
+var grantGlobalObjectSql = `
+SELECT NULL AS schema_name
+  , 'DATABASE' AS compare_name
+  , 'DATABASE' AS type
+  , d.datname::text AS object_name
+  , pg_catalog.pg_get_userbyid(d.datdba) AS owner
+  , unnest(COALESCE(d.datacl, pg_catalog.acldefault('d', d.datdba))) AS object_acl
+FROM pg_catalog.pg_database d
+WHERE d.datname = current_database()
+UNION ALL
+SELECT NULL AS schema_name
+  , 'FOREIGN DATA WRAPPER.' || w.fdwname::text AS compare_name
+  , 'FOREIGN DATA WRAPPER' AS type
+  , w.fdwname::text AS object_name
+  , pg_catalog.pg_get_userbyid(w.fdwowner) AS owner
+  , unnest(COALESCE(w.fdwacl, pg_catalog.acldefault('F', w.fdwowner))) AS object_acl
+FROM pg_catalog.pg_foreign_data_wrapper w
+UNION ALL
+SELECT NULL AS schema_name
+  , 'FOREIGN SERVER.' || s.srvname::text AS compare_name
+  , 'FOREIGN SERVER' AS type
+  , s.srvname::text AS object_name
+  , pg_catalog.pg_get_userbyid(s.srvowner) AS owner
+  , unnest(COALESCE(s.srvacl, pg_catalog.acldefault('S', s.srvowner))) AS object_acl
+FROM pg_catalog.pg_foreign_server s
+UNION ALL
+SELECT NULL AS schema_name
+  , 'LANGUAGE.' || l.lanname::text AS compare_name
+  , 'LANGUAGE' AS type
+  , l.lanname::text AS object_name
+  , pg_catalog.pg_get_userbyid(l.lanowner) AS owner
+  , unnest(COALESCE(l.lanacl, pg_catalog.acldefault('l', l.lanowner))) AS object_acl
+FROM pg_catalog.pg_language l;
+`
+
+// ==================================
+// GrantObjectRows definition
+// ==================================
+
+// GrantObjectRows is a sortable slice of string maps
+type GrantObjectRows []map[string]string
+
+func (slice GrantObjectRows) Len() int {
+	return len(slice)
+}
+
+func (slice GrantObjectRows) Less(i, j int) bool {
+	if slice[i]["compare_name"] != slice[j]["compare_name"] {
+		return slice[i]["compare_name"] < slice[j]["compare_name"]
+	}
+
+	// Compare the grantee and grantor parts of the ACL
+	return compareAcls(slice[i]["object_acl"], slice[i]["owner"], slice[j]["object_acl"], slice[j]["owner"]) < 0
+}
+
+func (slice GrantObjectRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ==================================
+// GrantObjectSchema definition
+// (implements Schema -- defined in pgdiff.go)
+// ==================================
+
+// GrantObjectSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+type GrantObjectSchema struct {
+	rows   GrantObjectRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *GrantObjectSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *GrantObjectSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *GrantObjectSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*GrantObjectSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare needs a GrantObjectSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	if val != 0 {
+		return val
+	}
+
+	val = compareAcls(c.get("object_acl"), c.get("owner"), c2.get("object_acl"), c2.get("owner"))
+	return val
+}
+
+// objectName returns the type and name of the current object as used in GRANT and REVOKE,
+// qualified with the given schema when the object lives in one
+func (c *GrantObjectSchema) objectName(schema string) string {
+	switch c.get("type") {
+	case "SCHEMA":
+		return "SCHEMA " + schema
+	case "DATABASE", "FOREIGN DATA WRAPPER", "FOREIGN SERVER", "LANGUAGE":
+		return c.get("type") + " " + c.get("object_name")
+	}
+	return fmt.Sprintf("%s %s.%s", c.get("type"), schema, c.get("object_name"))
+}
+
+// Add prints SQL to add the grant
+func (c *GrantObjectSchema) Add() {
+	schema := pkg.DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+
+	item := parseAclItem(c.get("object_acl"))
+	target := aclTarget{on: c.objectName(schema), grantedBy: grantorUnlessOwner(item, c.get("owner"))}
+	if c.get("type") == "DATABASE" {
+		// The databases being compared rarely share a name
+		target.on = "DATABASE " + pkg.DbInfo2.DbName
+	}
+	target.add(item)
+}
+
+// Drop prints SQL to drop the grant
+func (c *GrantObjectSchema) Drop() {
+	item := parseAclItem(c.get("object_acl"))
+	target := aclTarget{on: c.objectName(c.get("schema_name")), grantedBy: grantorUnlessOwner(item, c.get("owner"))}
+	target.drop(item)
+}
+
+// Change handles the case where the object, grantee and grantor match, but the grant does not
+func (c *GrantObjectSchema) Change(obj interface{}) {
+	c2, ok := obj.(*GrantObjectSchema)
+	if !ok {
+		fmt.Println("-- Error!!!, Change needs a GrantObjectSchema instance", c2)
+	}
+
+	item1 := parseAclItem(c.get("object_acl"))
+	item2 := parseAclItem(c2.get("object_acl"))
+	target := aclTarget{on: c2.objectName(c2.get("schema_name")), grantedBy: grantorUnlessOwner(item2, c2.get("owner"))}
+	target.change(item1, item2)
+}
+
+// ==================================
+// Functions
+// ==================================
+
+// CompareGrantObjects outputs SQL to make the permissions granted on schemas, functions, procedures,
+// types, domains, and (when the same schemas are compared) the database, foreign data wrappers,
+// foreign servers and languages match between DBs or schemas
+func CompareGrantObjects(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	grantObjectSqlTemplate.Execute(buf1, pkg.DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	grantObjectSqlTemplate.Execute(buf2, pkg.DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(GrantObjectRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+
+	rows2 := make(GrantObjectRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+
+	// Database-wide objects are only compared when the same schemas are being compared
+	if pkg.DbInfo1.DbSchema == pkg.DbInfo2.DbSchema {
+		globalChan1, _ := pgutil.QueryStrings(conn1, grantGlobalObjectSql)
+		for row := range globalChan1 {
+			rows1 = append(rows1, row)
+		}
+
+		globalChan2, _ := pgutil.QueryStrings(conn2, grantGlobalObjectSql)
+		for row := range globalChan2 {
+			rows2 = append(rows2, row)
+		}
+	}
+	sort.Sort(rows1)
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 pkg.Schema = &GrantObjectSchema{rows: rows1, rowNum: -1}
+	var schema2 pkg.Schema = &GrantObjectSchema{rows: rows2, rowNum: -1}
+
+	pkg.DoDiff(schema1, schema2)
+}
@@ -11,7 +11,6 @@ import (
 	"database/sql"
 	"fmt"
 	"sort"
-	"strings"
 	"text/template"
 
 	"github.com/jiapeish/pgdiff/pgutil"
@@ -34,10 +33,12 @@ SELECT n.nspname AS schema_name
     WHEN 'f' THEN 'FOREIGN TABLE'
     END as type
   , c.relname AS relationship_name
+  , pg_catalog.pg_get_userbyid(c.relowner) AS owner
   , unnest(c.relacl) AS relationship_acl
 FROM pg_catalog.pg_class c
 LEFT JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
 WHERE c.relkind IN ('r', 'v', 'S', 'f')
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
 --AND pg_catalog.pg_table_is_visible(c.oid)
 {{ if eq $.DbSchema "*" }}
 AND n.nspname NOT LIKE 'pg_%'
@@ -68,16 +69,8 @@ func (slice GrantRelationshipRows) Less(i, j int) bool {
 		return slice[i]["compare_name"] < slice[j]["compare_name"]
 	}
 
-	// Only compare the role part of the ACL
-	// Not yet sure if this is absolutely necessary
-	// (or if we could just compare the entire ACL string)
-	relRole1, _ := parseAcl(slice[i]["relationship_acl"])
-	relRole2, _ := parseAcl(slice[j]["relationship_acl"])
-	if relRole1 != relRole2 {
-		return relRole1 < relRole2
-	}
-
-	return false
+	// Compare the grantee and grantor parts of the ACL
+	return compareAcls(slice[i]["relationship_acl"], slice[i]["owner"], slice[j]["relationship_acl"], slice[j]["owner"]) < 0
 }
 
 func (slice GrantRelationshipRows) Swap(i, j int) {
@@ -135,12 +128,28 @@ func (c *GrantRelationshipSchema) Compare(obj interface{}) int {
 		return val
 	}
 
-	relRole1, _ := parseAcl(c.get("relationship_acl"))
-	relRole2, _ := parseAcl(c2.get("relationship_acl"))
-	val = pgutil.CompareStrings(relRole1, relRole2)
+	val = compareAcls(c.get("relationship_acl"), c.get("owner"), c2.get("relationship_acl"), c2.get("owner"))
 	return val
 }
 
+// objectType returns the keyword GRANT and REVOKE need for the current relationship
+// (USAGE is not a valid privilege for the TABLE form, so sequences must be named as such)
+func (c *GrantRelationshipSchema) objectType() string {
+	if c.get("type") == "SEQUENCE" {
+		return "SEQUENCE"
+	}
+	return "TABLE"
+}
+
+// aclTarget returns what it takes to write GRANT and REVOKE statements for the current relationship
+// (in the given schema) and ACL item
+func (c *GrantRelationshipSchema) aclTarget(schema string, item aclItem) aclTarget {
+	return aclTarget{
+		on:        fmt.Sprintf("%s %s.%s", c.objectType(), schema, c.get("relationship_name")),
+		grantedBy: grantorUnlessOwner(item, c.get("owner")),
+	}
+}
+
 // Add prints SQL to add the grant
 func (c *GrantRelationshipSchema) Add() {
 	schema := pkg.DbInfo2.DbSchema
@@ -148,52 +157,26 @@ func (c *GrantRelationshipSchema) Add() {
 		schema = c.get("schema_name")
 	}
 
-	role, grants := parseGrants(c.get("relationship_acl"))
-	fmt.Printf("GRANT %s ON %s.%s TO %s; -- Add\n", strings.Join(grants, ", "), schema, c.get("relationship_name"), role)
+	item := parseAclItem(c.get("relationship_acl"))
+	c.aclTarget(schema, item).add(item)
 }
 
 // Drop prints SQL to drop the grant
 func (c *GrantRelationshipSchema) Drop() {
-	role, grants := parseGrants(c.get("relationship_acl"))
-	fmt.Printf("REVOKE %s ON %s.%s FROM %s; -- Drop\n", strings.Join(grants, ", "), c.get("schema_name"), c.get("relationship_name"), role)
+	item := parseAclItem(c.get("relationship_acl"))
+	c.aclTarget(c.get("schema_name"), item).drop(item)
 }
 
-// Change handles the case where the relationship and column match, but the grant does not
+// Change handles the case where the relationship, grantee and grantor match, but the grant does not
 func (c *GrantRelationshipSchema) Change(obj interface{}) {
 	c2, ok := obj.(*GrantRelationshipSchema)
 	if !ok {
 		fmt.Println("-- Error!!!, Change needs a GrantRelationshipSchema instance", c2)
 	}
 
-	role, grants1 := parseGrants(c.get("relationship_acl"))
-	_, grants2 := parseGrants(c2.get("relationship_acl"))
-
-	// Find grants in the first db that are not in the second
-	// (for this relationship and owner)
-	var grantList []string
-	for _, g := range grants1 {
-		if !pgutil.ContainsString(grants2, g) {
-			grantList = append(grantList, g)
-		}
-	}
-	if len(grantList) > 0 {
-		fmt.Printf("GRANT %s ON %s.%s TO %s; -- Change\n", strings.Join(grantList, ", "), c2.get("schema_name"), c.get("relationship_name"), role)
-	}
-
-	// Find grants in the second db that are not in the first
-	// (for this relationship and owner)
-	var revokeList []string
-	for _, g := range grants2 {
-		if !pgutil.ContainsString(grants1, g) {
-			revokeList = append(revokeList, g)
-		}
-	}
-	if len(revokeList) > 0 {
-		fmt.Printf("REVOKE %s ON %s.%s FROM %s; -- Change\n", strings.Join(revokeList, ", "), c2.get("schema_name"), c.get("relationship_name"), role)
-	}
-
-	//	fmt.Printf("--1 rel:%s, relAcl:%s, col:%s, colAcl:%s\n", c.get("relationship_name"), c.get("relationship_acl"), c.get("column_name"), c.get("column_acl"))
-	//	fmt.Printf("--2 rel:%s, relAcl:%s, col:%s, colAcl:%s\n", c2.get("relationship_name"), c2.get("relationship_acl"), c2.get("column_name"), c2.get("column_acl"))
+	item1 := parseAclItem(c.get("relationship_acl"))
+	item2 := parseAclItem(c2.get("relationship_acl"))
+	c2.aclTarget(c2.get("schema_name"), item2).change(item1, item2)
 }
 
 // ==================================
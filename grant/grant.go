@@ -13,9 +13,11 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+
+	"github.com/jiapeish/pgdiff/pgutil"
 )
 
-var aclRegex = regexp.MustCompile(`([a-zA-Z0-9_]+)*=([rwadDxtXUCcT]+)/([a-zA-Z0-9_]+)$`)
+var plainRoleRegex = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
 
 var permMap = map[string]string{
 	"a": "INSERT",
@@ -32,10 +34,18 @@ var permMap = map[string]string{
 	"T": "TEMPORARY",
 }
 
+// aclItem is one parsed entry of an ACL (access control list)
+type aclItem struct {
+	grantee      string   // "public" when the privileges are granted to PUBLIC
+	grantor      string   // role that granted the privileges
+	privileges   []string // sorted permission words, e.g. INSERT, SELECT
+	grantOptions []string // the privileges that were granted WITH GRANT OPTION
+}
+
 /*
-parseGrants converts an ACL (access control list) line into a role and a slice of permission strings
+parseAclItem converts an ACL (access control list) line into an aclItem
 
-Example of an ACL: user1=rwa/c42
+Example of an ACL: user1=r*wa/c42
 
 rolename=xxxx -- privileges granted to a role
         =xxxx -- privileges granted to PUBLIC
@@ -54,38 +64,214 @@ rolename=xxxx -- privileges granted to a role
       arwdDxt -- ALL PRIVILEGES (for tables, varies for other objects)
             * -- grant option for preceding privilege
         /yyyy -- role that granted this privilege
+
+Role names that are not plain identifiers are double-quoted, with embedded quotes doubled.
 */
-func parseGrants(acl string) (string, []string) {
-	role, perms := parseAcl(acl)
-	if len(role) == 0 && len(acl) == 0 {
-		return role, make([]string, 0)
+func parseAclItem(acl string) aclItem {
+	item := aclItem{privileges: make([]string, 0), grantOptions: make([]string, 0)}
+	grantee, rest := readAclRole(acl)
+	if !strings.HasPrefix(rest, "=") {
+		return item
 	}
+	rest = rest[1:]
+
+	perms := rest
+	if i := strings.Index(rest, "/"); i >= 0 {
+		perms = rest[:i]
+		item.grantor, _ = readAclRole(rest[i+1:])
+	}
+
 	// For each character in perms, convert it to a word found in permMap
 	// e.g. 'a' maps to 'INSERT'
-	permWords := make(sort.StringSlice, 0)
+	var permWord string
 	for _, c := range strings.Split(perms, "") {
-		permWord := permMap[c]
+		if c == "*" {
+			if len(permWord) > 0 {
+				item.grantOptions = append(item.grantOptions, permWord)
+			}
+			continue
+		}
+		permWord = permMap[c]
 		if len(permWord) > 0 {
-			permWords = append(permWords, permWord)
-		} else {
-			fmt.Printf("-- Error, found permission character we haven't coded for: %s", c)
+			item.privileges = append(item.privileges, permWord)
+		} else if len(c) > 0 {
+			fmt.Printf("-- Error, found permission character we haven't coded for: %s\n", c)
+		}
+	}
+	sort.Strings(item.privileges)
+	sort.Strings(item.grantOptions)
+
+	item.grantee = grantee
+	if len(item.grantee) == 0 {
+		item.grantee = "public"
+	}
+	return item
+}
+
+// readAclRole reads a possibly quoted role name from the start of the given part of an ACL
+// and returns it along with the rest of the string
+func readAclRole(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexAny(s, "=/")
+		if i < 0 {
+			return s, ""
+		}
+		return s[:i], s[i:]
+	}
+
+	var name strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] == '"' {
+			if i+1 < len(s) && s[i+1] == '"' {
+				name.WriteByte('"')
+				i++
+				continue
+			}
+			return name.String(), s[i+1:]
+		}
+		name.WriteByte(s[i])
+	}
+	return name.String(), ""
+}
+
+// compareAcls compares two ACL lines by grantee and then grantor, which together identify
+// an entry of an object's ACL.  A grantor that is the object's owner (owner1 or owner2) is
+// compared as an empty string, so the owner's grants match even when the owners differ.
+func compareAcls(acl1 string, owner1 string, acl2 string, owner2 string) int {
+	item1 := parseAclItem(acl1)
+	item2 := parseAclItem(acl2)
+	val := pgutil.CompareStrings(item1.grantee, item2.grantee)
+	if val != 0 {
+		return val
+	}
+	return pgutil.CompareStrings(grantorUnlessOwner(item1, owner1), grantorUnlessOwner(item2, owner2))
+}
+
+// quoteRole returns the role name as it must be written in SQL
+func quoteRole(role string) string {
+	if plainRoleRegex.MatchString(role) {
+		return role
+	}
+	return `"` + strings.Replace(role, `"`, `""`, -1) + `"`
+}
+
+// aclTarget holds what it takes to write GRANT and REVOKE statements for one object
+type aclTarget struct {
+	prefix          string // written before GRANT or REVOKE, e.g. "ALTER DEFAULT PRIVILEGES FOR ROLE u1 "
+	privilegeSuffix string // written after each privilege, e.g. " (column1)"
+	on              string // the object, e.g. "TABLE s1.table1"
+	grantedBy       string // grantor to name in GRANTED BY (empty when it is the object owner)
+}
+
+// privilegeList joins the privileges for use in a GRANT or REVOKE statement
+func (t aclTarget) privilegeList(privileges []string) string {
+	list := make([]string, len(privileges))
+	for i, p := range privileges {
+		list[i] = p + t.privilegeSuffix
+	}
+	return strings.Join(list, ", ")
+}
+
+// grantedByClause returns the GRANTED BY clause, if one is needed.  PostgreSQL only accepts the
+// current user there, so setRole and resetRole wrap the statement to act as the grantor.
+func (t aclTarget) grantedByClause() string {
+	if len(t.grantedBy) == 0 {
+		return ""
+	}
+	return " GRANTED BY " + quoteRole(t.grantedBy)
+}
+
+// setRole returns a SET ROLE statement for the grantor, if one is needed
+func (t aclTarget) setRole() string {
+	if len(t.grantedBy) == 0 {
+		return ""
+	}
+	return "SET ROLE " + quoteRole(t.grantedBy) + "; "
+}
+
+// resetRole returns the RESET ROLE statement that follows setRole
+func (t aclTarget) resetRole() string {
+	if len(t.grantedBy) == 0 {
+		return ""
+	}
+	return "RESET ROLE; "
+}
+
+// grant prints a GRANT statement
+func (t aclTarget) grant(privileges []string, grantee string, withGrantOption bool, comment string) {
+	if len(privileges) == 0 {
+		return
+	}
+	option := ""
+	if withGrantOption {
+		option = " WITH GRANT OPTION"
+	}
+	fmt.Printf("%s%sGRANT %s ON %s TO %s%s%s; %s-- %s\n", t.setRole(), t.prefix, t.privilegeList(privileges), t.on, quoteRole(grantee), option, t.grantedByClause(), t.resetRole(), comment)
+}
+
+// revoke prints a REVOKE statement, or a REVOKE GRANT OPTION FOR statement
+func (t aclTarget) revoke(privileges []string, grantee string, grantOptionFor bool, comment string) {
+	if len(privileges) == 0 {
+		return
+	}
+	option := ""
+	if grantOptionFor {
+		option = "GRANT OPTION FOR "
+	}
+	fmt.Printf("%s%sREVOKE %s%s ON %s FROM %s%s; %s-- %s\n", t.setRole(), t.prefix, option, t.privilegeList(privileges), t.on, quoteRole(grantee), t.grantedByClause(), t.resetRole(), comment)
+}
+
+// add prints the statements that grant everything in the ACL item
+func (t aclTarget) add(item aclItem) {
+	t.grant(subtract(item.privileges, item.grantOptions), item.grantee, false, "Add")
+	t.grant(item.grantOptions, item.grantee, true, "Add")
+}
+
+// drop prints the statement that revokes everything in the ACL item
+func (t aclTarget) drop(item aclItem) {
+	t.revoke(item.privileges, item.grantee, false, "Drop")
+}
+
+// change prints the statements that turn the second ACL item into the first one
+func (t aclTarget) change(item1 aclItem, item2 aclItem) {
+	// Privileges (or grant options) in the first db that are not in the second
+	t.grant(subtract(subtract(item1.privileges, item2.privileges), item1.grantOptions), item1.grantee, false, "Change")
+	t.grant(subtract(item1.grantOptions, item2.grantOptions), item1.grantee, true, "Change")
+
+	// Privileges in the second db that are not in the first (which takes their grant option too)
+	t.revoke(subtract(item2.privileges, item1.privileges), item1.grantee, false, "Change")
+
+	// Grant options in the second db on privileges that the first db has without them
+	t.revoke(subtract(intersect(item2.grantOptions, item1.privileges), item1.grantOptions), item1.grantee, true, "Change")
+}
+
+// subtract returns the strings in list1 that are not in list2
+func subtract(list1 []string, list2 []string) []string {
+	var result []string
+	for _, s := range list1 {
+		if !pgutil.ContainsString(list2, s) {
+			result = append(result, s)
 		}
 	}
-	permWords.Sort()
-	return role, permWords
+	return result
 }
 
-// parseAcl parses an ACL (access control list) string (e.g. 'c42=aur/postgres') into a role and
-// a string made up of one-character permissions
-func parseAcl(acl string) (role string, perms string) {
-	role, perms = "", ""
-	matches := aclRegex.FindStringSubmatch(acl)
-	if matches != nil {
-		role = matches[1]
-		perms = matches[2]
-		if len(role) == 0 {
-			role = "public"
+// intersect returns the strings in list1 that are also in list2
+func intersect(list1 []string, list2 []string) []string {
+	var result []string
+	for _, s := range list1 {
+		if pgutil.ContainsString(list2, s) {
+			result = append(result, s)
 		}
 	}
-	return role, perms
+	return result
+}
+
+// grantorUnlessOwner returns the grantor of the ACL item, or an empty string when the object's
+// owner granted it (which GRANT and REVOKE assume by default)
+func grantorUnlessOwner(item aclItem, owner string) string {
+	if item.grantor == owner {
+		return ""
+	}
+	return item.grantor
 }
@@ -2,6 +2,7 @@ package grant
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -11,15 +12,66 @@ func Test_parseAcls(t *testing.T) {
 	doParseAcls(t, "u3=rwad/postgres", "u3", 4) // second of two lines
 	doParseAcls(t, "user2=arwxt/postgres", "user2", 5)
 	doParseAcls(t, "", "", 0)
+	doParseAcls(t, "user1=r*w*a/c42", "user1", 3)
+	doParseAcls(t, `"User-1"=r/c42`, "User-1", 1)
+	doParseAcls(t, `"a ""b"""=X/c42`, `a "b"`, 1)
 }
 
 func doParseAcls(t *testing.T, acl string, expectedRole string, expectedPermCount int) {
 	fmt.Println("Testing", acl)
-	role, perms := parseAcl(acl)
-	if role != expectedRole {
-		t.Error("Wrong role parsed: " + role + " instead of " + expectedRole)
+	item := parseAclItem(acl)
+	if item.grantee != expectedRole {
+		t.Error("Wrong role parsed: " + item.grantee + " instead of " + expectedRole)
 	}
-	if len(perms) != expectedPermCount {
-		t.Errorf("Incorrect number of permissions parsed: %d instead of %d", len(perms), expectedPermCount)
+	if len(item.privileges) != expectedPermCount {
+		t.Errorf("Incorrect number of permissions parsed: %d instead of %d", len(item.privileges), expectedPermCount)
+	}
+}
+
+func Test_parseAclGrantOptions(t *testing.T) {
+	doParseAclGrantOptions(t, "user1=rwa/c42", "c42", "")
+	doParseAclGrantOptions(t, "user1=r*wa*/c42", "c42", "INSERT,SELECT")
+	doParseAclGrantOptions(t, "=X*/postgres", "postgres", "EXECUTE")
+	doParseAclGrantOptions(t, `u2=U/"Grant-Or"`, "Grant-Or", "")
+}
+
+func doParseAclGrantOptions(t *testing.T, acl string, expectedGrantor string, expectedGrantOptions string) {
+	item := parseAclItem(acl)
+	if item.grantor != expectedGrantor {
+		t.Error("Wrong grantor parsed: " + item.grantor + " instead of " + expectedGrantor)
+	}
+	if strings.Join(item.grantOptions, ",") != expectedGrantOptions {
+		t.Error("Wrong grant options parsed: " + strings.Join(item.grantOptions, ",") + " instead of " + expectedGrantOptions)
+	}
+}
+
+func Test_compareAcls(t *testing.T) {
+	if compareAcls("u1=r/u2", "u4", "u1=rw/u2", "u4") != 0 {
+		t.Error("ACLs with the same grantee and grantor should compare equal")
+	}
+	if compareAcls("u1=r/u2", "u4", "u1=r/u3", "u4") >= 0 {
+		t.Error("ACLs with different grantors should not compare equal")
+	}
+	if compareAcls("=r/u2", "u4", "u1=r/u2", "u4") >= 0 {
+		t.Error("ACLs should be ordered by grantee first")
+	}
+	if compareAcls("=X/u1", "u1", "=X/u2", "u2") != 0 {
+		t.Error("ACLs granted by the owners should compare equal when the owners differ")
+	}
+	if compareAcls("u3=r/u1", "u1", "u3=r/u2", "u1") == 0 {
+		t.Error("ACLs granted by the owner and by another role should not compare equal")
+	}
+}
+
+func Test_quoteRole(t *testing.T) {
+	doQuoteRole(t, "user1", "user1")
+	doQuoteRole(t, "public", "public")
+	doQuoteRole(t, "User1", `"User1"`)
+	doQuoteRole(t, `a "b"`, `"a ""b"""`)
+}
+
+func doQuoteRole(t *testing.T, role string, expected string) {
+	if quoteRole(role) != expected {
+		t.Error("Wrong quoting of role " + role + ": " + quoteRole(role) + " instead of " + expected)
 	}
 }
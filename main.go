@@ -61,7 +61,7 @@ func main() {
 	}
 
 	if len(args) == 0 {
-		fmt.Println("The required first argument is SchemaType: SCHEMA, ROLE, SEQUENCE, TABLE, VIEW, MATVIEW, COLUMN, INDEX, FOREIGN_KEY, OWNER, GRANT_RELATIONSHIP, GRANT_ATTRIBUTE")
+		fmt.Println("The required first argument is SchemaType: SCHEMA, EXTENSION, ROLE, FOREIGN_DATA_WRAPPER, FOREIGN_SERVER, USER_MAPPING, TYPE, SEQUENCE, TABLE, PARTITION, FOREIGN_TABLE, VIEW, MATVIEW, COLUMN, INDEX, STORAGE, STATISTICS, FOREIGN_KEY, CHECK_CONSTRAINT, TRIGGER, EVENT_TRIGGER, POLICY, COMMENT, OWNER, GRANT_RELATIONSHIP, GRANT_ATTRIBUTE, GRANT_OBJECT, DEFAULT_PRIVILEGE")
 		os.Exit(1)
 	}
 
@@ -93,49 +93,94 @@ func main() {
 			pkg.CompareSchematas(conn1, conn2)
 		}
 		pkg.CompareSchematas(conn1, conn2)
+		pkg.CompareExtensions(conn1, conn2)
 		pkg.CompareRoles(conn1, conn2)
+		pkg.CompareForeignDataWrappers(conn1, conn2) // after extensions, which may provide the handlers, and the roles that own them
+		pkg.CompareForeignServers(conn1, conn2)
+		pkg.CompareUserMappings(conn1, conn2)
+		pkg.CompareTypes(conn1, conn2)
 		pkg.CompareSequences(conn1, conn2)
 		pkg.CompareTables(conn1, conn2)
+		pkg.ComparePartitions(conn1, conn2)
+		pkg.CompareForeignTables(conn1, conn2) // after partitions, which foreign tables may be attached to
 		pkg.CompareColumns(conn1, conn2)
 		pkg.CompareIndexes(conn1, conn2) // includes PK and Unique constraints
+		pkg.CompareStorage(conn1, conn2) // after the tables, columns and indexes it alters
+		pkg.CompareStatistics(conn1, conn2)
 		pkg.CompareViews(conn1, conn2)
 		pkg.CompareMatViews(conn1, conn2)
 		pkg.CompareForeignKeys(conn1, conn2)
 		pkg.CompareFunctions(conn1, conn2)
+		pkg.CompareCheckConstraints(conn1, conn2) // after functions, which checks may call
 		pkg.CompareTriggers(conn1, conn2)
+		pkg.CompareEventTriggers(conn1, conn2)
+		pkg.ComparePolicies(conn1, conn2)
+		pkg.CompareComments(conn1, conn2)
 		pkg.CompareOwners(conn1, conn2)
 		grant.CompareGrantRelationships(conn1, conn2)
 		grant.CompareGrantAttributes(conn1, conn2)
+		grant.CompareGrantObjects(conn1, conn2)
+		grant.CompareDefaultPrivileges(conn1, conn2)
 	} else if schemaType == "SCHEMA" {
 		pkg.CompareSchematas(conn1, conn2)
+	} else if schemaType == "EXTENSION" {
+		pkg.CompareExtensions(conn1, conn2)
+	} else if schemaType == "FOREIGN_DATA_WRAPPER" {
+		pkg.CompareForeignDataWrappers(conn1, conn2)
+	} else if schemaType == "FOREIGN_SERVER" {
+		pkg.CompareForeignServers(conn1, conn2)
 	} else if schemaType == "ROLE" {
 		pkg.CompareRoles(conn1, conn2)
+	} else if schemaType == "USER_MAPPING" {
+		pkg.CompareUserMappings(conn1, conn2)
+	} else if schemaType == "TYPE" {
+		pkg.CompareTypes(conn1, conn2)
 	} else if schemaType == "SEQUENCE" {
 		pkg.CompareSequences(conn1, conn2)
 	} else if schemaType == "TABLE" {
 		pkg.CompareTables(conn1, conn2)
+	} else if schemaType == "PARTITION" {
+		pkg.ComparePartitions(conn1, conn2)
+	} else if schemaType == "FOREIGN_TABLE" {
+		pkg.CompareForeignTables(conn1, conn2)
 	} else if schemaType == "COLUMN" {
 		pkg.CompareColumns(conn1, conn2)
 	} else if schemaType == "TABLE_COLUMN" {
 		pkg.CompareTableColumns(conn1, conn2)
 	} else if schemaType == "INDEX" {
 		pkg.CompareIndexes(conn1, conn2)
+	} else if schemaType == "STORAGE" {
+		pkg.CompareStorage(conn1, conn2)
+	} else if schemaType == "STATISTICS" {
+		pkg.CompareStatistics(conn1, conn2)
 	} else if schemaType == "VIEW" {
 		pkg.CompareViews(conn1, conn2)
 	} else if schemaType == "MATVIEW" {
 		pkg.CompareMatViews(conn1, conn2)
 	} else if schemaType == "FOREIGN_KEY" {
 		pkg.CompareForeignKeys(conn1, conn2)
+	} else if schemaType == "CHECK_CONSTRAINT" {
+		pkg.CompareCheckConstraints(conn1, conn2)
 	} else if schemaType == "FUNCTION" {
 		pkg.CompareFunctions(conn1, conn2)
 	} else if schemaType == "TRIGGER" {
 		pkg.CompareTriggers(conn1, conn2)
+	} else if schemaType == "EVENT_TRIGGER" {
+		pkg.CompareEventTriggers(conn1, conn2)
+	} else if schemaType == "POLICY" {
+		pkg.ComparePolicies(conn1, conn2)
+	} else if schemaType == "COMMENT" {
+		pkg.CompareComments(conn1, conn2)
 	} else if schemaType == "OWNER" {
 		pkg.CompareOwners(conn1, conn2)
 	} else if schemaType == "GRANT_RELATIONSHIP" {
 		grant.CompareGrantRelationships(conn1, conn2)
 	} else if schemaType == "GRANT_ATTRIBUTE" {
 		grant.CompareGrantAttributes(conn1, conn2)
+	} else if schemaType == "GRANT_OBJECT" {
+		grant.CompareGrantObjects(conn1, conn2)
+	} else if schemaType == "DEFAULT_PRIVILEGE" {
+		grant.CompareDefaultPrivileges(conn1, conn2)
 	} else {
 		fmt.Println("Not yet handled:", schemaType)
 	}
@@ -162,8 +207,14 @@ Options:
   -d, --dbname2 : second database name 
   -S, --schema1 : first schema.  default is all schemas
   -s, --schema2 : second schema. default is all schemas
-
-<schemaTpe> can be: ALL, SCHEMA, ROLE, SEQUENCE, TABLE, TABLE_COLUMN, VIEW, MATVIEW, COLUMN, INDEX, FOREIGN_KEY, OWNER, GRANT_RELATIONSHIP, GRANT_ATTRIBUTE, TRIGGER, FUNCTION`)
+  --sync-sequence-values : make SEQUENCE set db2's sequence values to db1's
+  --refresh-matviews     : make MATVIEW refresh db2's materialized views (concurrently when possible)
+  --role-pattern         : make ROLE compare only the roles matching this regular expression
+  --referenced-roles     : make ROLE compare only the roles that own or have privileges on objects in the compared schemas
+  --role-passwords       : how ROLE sets the passwords of the roles it creates: none (default), random or copy
+  --role-password-file   : where ROLE writes the generated passwords.  default is pgdiff-role-passwords.txt
+
+<schemaTpe> can be: ALL, SCHEMA, EXTENSION, ROLE, FOREIGN_DATA_WRAPPER, FOREIGN_SERVER, USER_MAPPING, TYPE, SEQUENCE, TABLE, PARTITION, FOREIGN_TABLE, TABLE_COLUMN, VIEW, MATVIEW, COLUMN, INDEX, STORAGE, STATISTICS, FOREIGN_KEY, CHECK_CONSTRAINT, OWNER, GRANT_RELATIONSHIP, GRANT_ATTRIBUTE, GRANT_OBJECT, DEFAULT_PRIVILEGE, TRIGGER, EVENT_TRIGGER, POLICY, COMMENT, FUNCTION`)
 
 	os.Exit(2)
 }
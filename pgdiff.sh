@@ -69,20 +69,35 @@ function rundiff() {
     echo
 }
 
+rundiff EXTENSION
 rundiff ROLE
+rundiff FOREIGN_DATA_WRAPPER
+rundiff FOREIGN_SERVER
+rundiff USER_MAPPING
 rundiff FUNCTION
 rundiff SCHEMA
+rundiff TYPE
 rundiff SEQUENCE
 rundiff TABLE
+rundiff PARTITION
+rundiff FOREIGN_TABLE
 rundiff COLUMN
 rundiff MATVIEW
 rundiff INDEX
+rundiff STORAGE
+rundiff STATISTICS
 rundiff VIEW
 rundiff TRIGGER
+rundiff EVENT_TRIGGER
+rundiff POLICY
+rundiff COMMENT
 rundiff OWNER
 rundiff FOREIGN_KEY
+rundiff CHECK_CONSTRAINT
 rundiff GRANT_RELATIONSHIP
 rundiff GRANT_ATTRIBUTE
+rundiff GRANT_OBJECT
+rundiff DEFAULT_PRIVILEGE
 
 echo
 echo "Done!"
@@ -218,7 +218,7 @@ func QueryStrings(db *sql.DB, query string) (chan map[string]string, []string) {
 					row[columnNames[i]] = fmt.Sprintf("%v", valPtr)
 				default:
 					row[columnNames[i]] = fmt.Sprintf("%v", valPtr)
-					fmt.Println("Warning, column %s is an unhandled type: %v", columnNames[i], valueType)
+					fmt.Printf("Warning, column %s is an unhandled type: %v\n", columnNames[i], valueType)
 				}
 			}
 			rowChan <- row
@@ -0,0 +1,70 @@
+//
+// scrampassword.go builds the SCRAM-SHA-256 verifiers PostgreSQL stores for passwords,
+// so a role's password can be set without the clear text appearing in SQL
+//
+// The verifier format is described here:
+// https://www.postgresql.org/docs/current/catalog-pg-authid.html
+//
+package pgutil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	scramIterations = 4096 // The iteration count PostgreSQL uses by default
+	scramSaltLength = 16   // The salt length PostgreSQL uses
+
+	passwordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// ScramSha256Verifier returns the SCRAM-SHA-256 verifier for the clear-text password, with a random salt
+func ScramSha256Verifier(password string) (string, error) {
+	salt := make([]byte, scramSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return scramSha256Verifier(password, salt, scramIterations), nil
+}
+
+// scramSha256Verifier returns the SCRAM-SHA-256 verifier for the clear-text password, salt and iteration count
+func scramSha256Verifier(password string, salt []byte, iterations int) string {
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+
+	clientKey := hmacSha256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSha256(saltedPassword, "Server Key")
+
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s", iterations,
+		base64.StdEncoding.EncodeToString(salt),
+		base64.StdEncoding.EncodeToString(storedKey[:]),
+		base64.StdEncoding.EncodeToString(serverKey))
+}
+
+// hmacSha256 returns the HMAC-SHA-256 of the message
+func hmacSha256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// RandomPassword returns a random password of the given length made of letters and digits
+func RandomPassword(length int) (string, error) {
+	password := make([]byte, length)
+	max := big.NewInt(int64(len(passwordChars)))
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = passwordChars[n.Int64()]
+	}
+	return string(password), nil
+}
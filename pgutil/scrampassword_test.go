@@ -0,0 +1,30 @@
+package pgutil
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/jiapeish/pgdiff/assert"
+)
+
+func Test_scramSha256Verifier(t *testing.T) {
+	// The password and salt from the example exchange in RFC 7677
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	verifier := scramSha256Verifier("pencil", salt, 4096)
+	assert.Equal(t, "SCRAM-SHA-256$4096:W22ZaJ0SNY7soEsUEjb6gQ==$WG5d8oPm3OtcPnkdi4Uo7BkeZkBFzpcXkuLmtbsT4qY=:wfPLwcE6nTWhTAmQ7tl2KeoiWGPlZqQxSrmfPwDl2dU=", verifier, "wrong SCRAM-SHA-256 verifier")
+}
+
+func Test_ScramSha256Verifier(t *testing.T) {
+	verifier1, _ := ScramSha256Verifier(secretPassword)
+	verifier2, _ := ScramSha256Verifier(secretPassword)
+	assert.True(t, strings.HasPrefix(verifier1, "SCRAM-SHA-256$4096:"), "error, verifier has the wrong prefix")
+	assert.NotEqual(t, verifier1, verifier2, "error, verifiers should have different salts")
+}
+
+func Test_RandomPassword(t *testing.T) {
+	password1, _ := RandomPassword(24)
+	password2, _ := RandomPassword(24)
+	assert.Equal(t, 24, len(password1), "wrong password length")
+	assert.NotEqual(t, password1, password2, "error, random passwords should differ")
+}
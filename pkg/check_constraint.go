@@ -0,0 +1,210 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	checkConstraintSqlTemplate = initCheckConstraintSqlTemplate()
+)
+
+// Initializes the Sql template
+func initCheckConstraintSqlTemplate() *template.Template {
+	sql := `
+SELECT {{if eq $.DbSchema "*" }}ns.nspname || '.' || {{end}}cl.relname || '.' || c.conname AS compare_name
+    , ns.nspname AS schema_name
+    , cl.relname AS table_name
+    , c.conname AS constraint_name
+    , pg_catalog.pg_get_constraintdef(c.oid, true) AS constraint_def
+    , c.convalidated AS validated
+FROM pg_catalog.pg_constraint c
+INNER JOIN pg_catalog.pg_class AS cl ON (c.conrelid = cl.oid)
+INNER JOIN pg_catalog.pg_namespace AS ns ON (ns.oid = cl.relnamespace)
+WHERE c.contype = 'c'
+AND c.conislocal
+AND cl.relkind IN ('r', 'p') -- foreign table checks are compared by FOREIGN_TABLE
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = cl.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*"}}
+AND ns.nspname NOT LIKE 'pg_%'
+AND ns.nspname <> 'information_schema'
+{{else}}
+AND ns.nspname = '{{$.DbSchema}}'
+{{end}}
+`
+	t := template.New("CheckConstraintSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// CheckConstraintRows definition
+// ==================================
+
+// CheckConstraintRows is a sortable slice of string maps
+type CheckConstraintRows []map[string]string
+
+func (slice CheckConstraintRows) Len() int {
+	return len(slice)
+}
+
+func (slice CheckConstraintRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice CheckConstraintRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ==================================
+// CheckConstraintSchema definition
+// (implements Schema -- defined in pgdiff.go)
+// ==================================
+
+// CheckConstraintSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+type CheckConstraintSchema struct {
+	rows   CheckConstraintRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *CheckConstraintSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *CheckConstraintSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *CheckConstraintSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*CheckConstraintSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a CheckConstraintSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// checkExpression returns the constraint definition without any trailing NOT VALID marker,
+// so that the validation state can be compared separately from the expression
+func (c *CheckConstraintSchema) checkExpression() string {
+	return strings.TrimSuffix(c.get("constraint_def"), " NOT VALID")
+}
+
+// addNotValid prints SQL that adds the check constraint without scanning the table, and then
+// validates it in a separate statement (if db1 has it validated) so the long scan only takes
+// a SHARE UPDATE EXCLUSIVE lock.  dropFirst drops the existing constraint in the same statement.
+func (c *CheckConstraintSchema) addNotValid(schema string, dropFirst bool) {
+	drop := ""
+	if dropFirst {
+		drop = fmt.Sprintf(" DROP CONSTRAINT %s,", c.get("constraint_name"))
+	}
+	fmt.Printf("ALTER TABLE %s.%s%s ADD CONSTRAINT %s %s NOT VALID;\n", schema, c.get("table_name"), drop, c.get("constraint_name"), c.checkExpression())
+	if c.get("validated") == "true" {
+		fmt.Printf("ALTER TABLE %s.%s VALIDATE CONSTRAINT %s;\n", schema, c.get("table_name"), c.get("constraint_name"))
+	}
+}
+
+// Add returns SQL to add the check constraint
+func (c *CheckConstraintSchema) Add() {
+	// The constraint was already defined in the CREATE TABLE statement
+	if isCreatedTable(c.get("schema_name"), c.get("table_name")) {
+		return
+	}
+
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+	c.addNotValid(schema, false)
+}
+
+// Drop returns SQL to drop the check constraint
+func (c *CheckConstraintSchema) Drop() {
+	fmt.Printf("ALTER TABLE %s.%s DROP CONSTRAINT %s; -- %s\n", c.get("schema_name"), c.get("table_name"), c.get("constraint_name"), c.get("constraint_def"))
+}
+
+// Change handles the case where the table and constraint name match, but the details do not
+func (c *CheckConstraintSchema) Change(obj interface{}) {
+	c2, ok := obj.(*CheckConstraintSchema)
+	if !ok {
+		fmt.Println("Error!!!, CheckConstraintSchema.Change(obj) needs a CheckConstraintSchema instance", c2)
+	}
+
+	if c.checkExpression() != c2.checkExpression() {
+		fmt.Printf("-- CHANGE: Different check constraint defs on %s:\n--    %s\n--    %s\n", c.get("table_name"), c.get("constraint_def"), c2.get("constraint_def"))
+		c.addNotValid(c2.get("schema_name"), true)
+		return
+	}
+
+	// The expressions match, so only the validation state can be different
+	if c.get("validated") != c2.get("validated") {
+		if c.get("validated") == "true" {
+			fmt.Printf("ALTER TABLE %s.%s VALIDATE CONSTRAINT %s;\n", c2.get("schema_name"), c.get("table_name"), c.get("constraint_name"))
+		} else {
+			fmt.Printf("-- Notice!, %s.%s is NOT VALID in db1 but validated in db2.  No change is needed.\n", c.get("table_name"), c.get("constraint_name"))
+		}
+	}
+}
+
+/*
+ * Compare the check constraints in the two databases.
+ */
+func CompareCheckConstraints(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	checkConstraintSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	checkConstraintSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(CheckConstraintRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(CheckConstraintRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// Check constraints of the tables that db2 does not have are part of their CREATE TABLE
+	loadDb2Tables(conn2)
+
+	// We have to explicitly type this as Schema here for some unknown reason
+	var schema1 Schema = &CheckConstraintSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &CheckConstraintSchema{rows: rows2, rowNum: -1}
+
+	// Compare the check constraints
+	DoDiff(schema1, schema2)
+}
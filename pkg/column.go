@@ -36,8 +36,16 @@ SELECT table_schema
     , is_identity
     , identity_generation
     , substring(udt_name from 2) AS array_type
+    , udt_schema
+    , udt_name
+    , domain_schema
+    , domain_name
+    , (SELECT c.relispartition FROM pg_catalog.pg_class c
+       WHERE c.oid = (quote_ident(table_schema) || '.' || quote_ident(table_name))::regclass) AS is_partition
 FROM information_schema.columns
 WHERE is_updatable = 'YES'
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_foreign_table ft WHERE ft.ftrelid = (quote_ident(table_schema) || '.' || quote_ident(table_name))::regclass) -- compared by FOREIGN_TABLE
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = (quote_ident(table_schema) || '.' || quote_ident(table_name))::regclass AND d.deptype = 'e')
 {{if eq $.DbSchema "*" }}
 AND table_schema NOT LIKE 'pg_%' 
 AND table_schema <> 'information_schema' 
@@ -66,12 +74,20 @@ SELECT a.table_schema
     , is_nullable
     , column_default
     , character_maximum_length
+    , substring(udt_name from 2) AS array_type
+    , udt_schema
+    , udt_name
+    , domain_schema
+    , domain_name
+    , (SELECT c.relispartition FROM pg_catalog.pg_class c
+       WHERE c.oid = (quote_ident(a.table_schema) || '.' || quote_ident(a.table_name))::regclass) AS is_partition
 FROM information_schema.columns a
 INNER JOIN information_schema.tables b
     ON a.table_schema = b.table_schema AND
        a.table_name = b.table_name AND
        b.table_type = 'BASE TABLE'
 WHERE is_updatable = 'YES'
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = (quote_ident(a.table_schema) || '.' || quote_ident(a.table_name))::regclass AND d.deptype = 'e')
 {{if eq $.DbSchema "*" }}
 AND a.table_schema NOT LIKE 'pg_%' 
 AND a.table_schema <> 'information_schema' 
@@ -151,6 +167,12 @@ func (c *ColumnSchema) Compare(obj interface{}) int {
 // Add prints SQL to add the column
 func (c *ColumnSchema) Add() {
 
+	// The column was already defined in the CREATE TABLE statement, or
+	// it belongs to a partition and is added through the partitioned table
+	if isCreatedTable(c.get("table_schema"), c.get("table_name")) || c.get("is_partition") == "true" {
+		return
+	}
+
 	schema := DbInfo2.DbSchema
 	if schema == "*" {
 		schema = c.get("table_schema")
@@ -162,7 +184,7 @@ func (c *ColumnSchema) Add() {
 		fmt.Println("-- Attempting to create identity columns in earlier versions will probably result in errors.")
 	}
 
-	if c.get("data_type") == "character varying" {
+	if c.get("data_type") == "character varying" && c.get("domain_name") == "null" {
 		maxLength, valid := getMaxLength(c.get("character_maximum_length"))
 		if !valid {
 			fmt.Printf("ALTER TABLE %s.%s ADD COLUMN %s character varying", schema, c.get("table_name"), c.get("column_name"))
@@ -170,15 +192,8 @@ func (c *ColumnSchema) Add() {
 			fmt.Printf("ALTER TABLE %s.%s ADD COLUMN %s character varying(%s)", schema, c.get("table_name"), c.get("column_name"), maxLength)
 		}
 	} else {
-		dataType := c.get("data_type")
-		//if c.get("data_type") == "ARRAY" {
-		//fmt.Println("-- Note that adding of array data types are not yet generated properly.")
-		//}
-		if dataType == "ARRAY" {
-			dataType = c.get("array_type") + "[]"
-		}
 		//fmt.Printf("ALTER TABLE %s.%s ADD COLUMN %s %s", schema, c.get("table_name"), c.get("column_name"), c.get("data_type"))
-		fmt.Printf("ALTER TABLE %s.%s ADD COLUMN %s %s", schema, c.get("table_name"), c.get("column_name"), dataType)
+		fmt.Printf("ALTER TABLE %s.%s ADD COLUMN %s %s", schema, c.get("table_name"), c.get("column_name"), c.dataType(schema))
 	}
 
 	if c.get("is_nullable") == "NO" {
@@ -195,8 +210,44 @@ func (c *ColumnSchema) Add() {
 	fmt.Printf(";\n")
 }
 
+// dataType returns the real data type of the column.  information_schema reports ARRAY or
+// USER-DEFINED for array, enum, composite, and range types, and the base type for domains.
+// User-defined types (and arrays of them) that live in the table's own schema are qualified with
+// the given schema.
+func (c *ColumnSchema) dataType(schema string) string {
+	dataType := c.get("data_type")
+	if c.get("domain_name") != "null" && len(c.get("domain_name")) > 0 {
+		domainSchema := c.get("domain_schema")
+		if domainSchema == c.get("table_schema") {
+			domainSchema = schema
+		}
+		dataType = domainSchema + "." + c.get("domain_name")
+	} else if dataType == "ARRAY" {
+		// An array type lives in the schema of its element type, so it is qualified the same way
+		dataType = c.get("array_type") + "[]"
+		if udtSchema := c.get("udt_schema"); udtSchema != "pg_catalog" {
+			if udtSchema == c.get("table_schema") {
+				udtSchema = schema
+			}
+			dataType = udtSchema + "." + dataType
+		}
+	} else if dataType == "USER-DEFINED" {
+		udtSchema := c.get("udt_schema")
+		if udtSchema == c.get("table_schema") {
+			udtSchema = schema
+		}
+		dataType = udtSchema + "." + c.get("udt_name")
+	}
+	return dataType
+}
+
 // Drop prints SQL to drop the column
 func (c *ColumnSchema) Drop() {
+	// Partition columns are dropped through the partitioned table
+	if c.get("is_partition") == "true" {
+		return
+	}
+
 	// if dropping column
 	fmt.Printf("ALTER TABLE %s.%s DROP COLUMN IF EXISTS %s;\n", c.get("table_schema"), c.get("table_name"), c.get("column_name"))
 }
@@ -208,16 +259,15 @@ func (c *ColumnSchema) Change(obj interface{}) {
 		fmt.Println("Error!!!, ColumnSchema.Change(obj) needs a ColumnSchema instance", c2)
 	}
 
-	// Adjust data type for array columns
-	dataType1 := c.get("data_type")
-	if dataType1 == "ARRAY" {
-		dataType1 = c.get("array_type") + "[]"
-	}
-	dataType2 := c2.get("data_type")
-	if dataType2 == "ARRAY" {
-		dataType2 = c2.get("array_type") + "[]"
+	// Partition columns are changed through the partitioned table
+	if c2.get("is_partition") == "true" {
+		return
 	}
 
+	// Adjust data type for array and user-defined columns
+	dataType1 := c.dataType(c2.get("table_schema"))
+	dataType2 := c2.dataType(c2.get("table_schema"))
+
 	// Detect column type change (mostly varchar length, or number size increase)
 	// (integer to/from bigint is OK)
 	if dataType1 == dataType2 {
@@ -313,6 +363,9 @@ func compare(conn1 *sql.DB, conn2 *sql.DB, tpl *template.Template) {
 	buf2 := new(bytes.Buffer)
 	tpl.Execute(buf2, DbInfo2)
 
+	// Columns of the tables that db2 does not have are part of their CREATE TABLE
+	loadDb2Tables(conn2)
+
 	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
 	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
 
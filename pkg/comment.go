@@ -0,0 +1,282 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	commentSqlTemplate = initCommentSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// Each branch of the union returns the COMMENT ON object type, the name of the object
+// without its schema, and (for triggers and constraints) the table it is on.  Objects
+// without a comment are returned too (with a null description), so that a comment is
+// only removed from an object that db1 has as well.  The dep_classid and dep_objid
+// columns identify the object (or table) that could be a member of an extension.
+func initCommentSqlTemplate() *template.Template {
+	sql := `
+SELECT x.object_type || ' ' || {{if eq $.DbSchema "*" }}x.schema_name || '.' || {{end}}COALESCE(x.object_name, '') || COALESCE(' ON ' || x.on_table, '') AS compare_name
+    , x.object_type
+    , x.schema_name
+    , x.object_name
+    , x.on_table
+    , x.description
+FROM (
+    SELECT 'SCHEMA' AS object_type
+        , n.nspname AS schema_name
+        , NULL AS object_name
+        , NULL AS on_table
+        , d.description
+        , 'pg_namespace'::regclass AS dep_classid
+        , n.oid AS dep_objid
+    FROM pg_catalog.pg_namespace n
+    LEFT OUTER JOIN pg_catalog.pg_description d ON (d.classoid = 'pg_namespace'::regclass AND d.objoid = n.oid)
+  UNION ALL
+    SELECT CASE c.relkind
+          WHEN 'v' THEN 'VIEW'
+          WHEN 'm' THEN 'MATERIALIZED VIEW'
+          WHEN 'i' THEN 'INDEX'
+          WHEN 'I' THEN 'INDEX'
+          WHEN 'S' THEN 'SEQUENCE'
+          WHEN 'f' THEN 'FOREIGN TABLE'
+          ELSE 'TABLE' END AS object_type
+        , n.nspname AS schema_name
+        , c.relname AS object_name
+        , NULL AS on_table
+        , d.description
+        , 'pg_class'::regclass AS dep_classid
+        , COALESCE(i.indrelid, c.oid) AS dep_objid
+    FROM pg_catalog.pg_class c
+    INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+    LEFT OUTER JOIN pg_catalog.pg_index i ON (i.indexrelid = c.oid)
+    LEFT OUTER JOIN pg_catalog.pg_description d ON (d.classoid = 'pg_class'::regclass AND d.objoid = c.oid AND d.objsubid = 0)
+    WHERE c.relkind IN ('r', 'p', 'v', 'm', 'i', 'I', 'S', 'f')
+  UNION ALL
+    SELECT 'COLUMN' AS object_type
+        , n.nspname AS schema_name
+        , c.relname || '.' || a.attname AS object_name
+        , NULL AS on_table
+        , d.description
+        , 'pg_class'::regclass AS dep_classid
+        , c.oid AS dep_objid
+    FROM pg_catalog.pg_attribute a
+    INNER JOIN pg_catalog.pg_class c ON (c.oid = a.attrelid)
+    INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+    LEFT OUTER JOIN pg_catalog.pg_description d ON (d.classoid = 'pg_class'::regclass AND d.objoid = c.oid AND d.objsubid = a.attnum)
+    WHERE a.attnum > 0
+    AND NOT a.attisdropped
+    AND c.relkind IN ('r', 'p', 'v', 'm', 'f', 'c')
+  UNION ALL
+    SELECT 'CONSTRAINT' AS object_type
+        , n.nspname AS schema_name
+        , con.conname AS object_name
+        , c.relname AS on_table
+        , d.description
+        , 'pg_class'::regclass AS dep_classid
+        , c.oid AS dep_objid
+    FROM pg_catalog.pg_constraint con
+    INNER JOIN pg_catalog.pg_class c ON (c.oid = con.conrelid)
+    INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+    LEFT OUTER JOIN pg_catalog.pg_description d ON (d.classoid = 'pg_constraint'::regclass AND d.objoid = con.oid)
+  UNION ALL
+    SELECT 'TRIGGER' AS object_type
+        , n.nspname AS schema_name
+        , t.tgname AS object_name
+        , c.relname AS on_table
+        , d.description
+        , 'pg_class'::regclass AS dep_classid
+        , c.oid AS dep_objid
+    FROM pg_catalog.pg_trigger t
+    INNER JOIN pg_catalog.pg_class c ON (c.oid = t.tgrelid)
+    INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+    LEFT OUTER JOIN pg_catalog.pg_description d ON (d.classoid = 'pg_trigger'::regclass AND d.objoid = t.oid)
+    WHERE NOT t.tgisinternal
+  UNION ALL
+    SELECT CASE p.prokind
+          WHEN 'p' THEN 'PROCEDURE'
+          WHEN 'a' THEN 'AGGREGATE'
+          ELSE 'FUNCTION' END AS object_type
+        , n.nspname AS schema_name
+        , p.proname || '(' || pg_catalog.pg_get_function_identity_arguments(p.oid) || ')' AS object_name
+        , NULL AS on_table
+        , d.description
+        , 'pg_proc'::regclass AS dep_classid
+        , p.oid AS dep_objid
+    FROM pg_catalog.pg_proc p
+    INNER JOIN pg_catalog.pg_namespace n ON (n.oid = p.pronamespace)
+    LEFT OUTER JOIN pg_catalog.pg_description d ON (d.classoid = 'pg_proc'::regclass AND d.objoid = p.oid)
+  UNION ALL
+    SELECT CASE WHEN t.typtype = 'd' THEN 'DOMAIN' ELSE 'TYPE' END AS object_type
+        , n.nspname AS schema_name
+        , t.typname AS object_name
+        , NULL AS on_table
+        , d.description
+        , 'pg_type'::regclass AS dep_classid
+        , t.oid AS dep_objid
+    FROM pg_catalog.pg_type t
+    INNER JOIN pg_catalog.pg_namespace n ON (n.oid = t.typnamespace)
+    LEFT OUTER JOIN pg_catalog.pg_description d ON (d.classoid = 'pg_type'::regclass AND d.objoid = t.oid)
+) AS x
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend dep WHERE dep.classid = x.dep_classid AND dep.objid = x.dep_objid AND dep.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND x.schema_name NOT LIKE 'pg_%'
+AND x.schema_name <> 'information_schema'
+{{else}}
+AND x.schema_name = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name;
+`
+	t := template.New("CommentSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// CommentRows definition
+// ==================================
+
+// CommentRows is a sortable slice of string maps
+type CommentRows []map[string]string
+
+func (slice CommentRows) Len() int {
+	return len(slice)
+}
+
+func (slice CommentRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice CommentRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// CommentSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+//
+// CommentSchema implements the Schema interface defined in pgdiff.go
+type CommentSchema struct {
+	rows   CommentRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *CommentSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *CommentSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *CommentSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*CommentSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a CommentSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// commentOn prints SQL that sets the comment of the current row's object (in the given schema)
+// to the given value, which is either a quoted literal or NULL
+func (c *CommentSchema) commentOn(schema string, value string) {
+	switch {
+	case c.get("object_type") == "SCHEMA":
+		fmt.Printf("COMMENT ON SCHEMA %s IS %s;\n", schema, value)
+	case c.get("on_table") != "null":
+		fmt.Printf("COMMENT ON %s %s ON %s.%s IS %s;\n", c.get("object_type"), c.get("object_name"), schema, c.get("on_table"), value)
+	default:
+		fmt.Printf("COMMENT ON %s %s.%s IS %s;\n", c.get("object_type"), schema, c.get("object_name"), value)
+	}
+}
+
+// Add returns SQL to add the comment to an object that db2 does not have (yet)
+func (c *CommentSchema) Add() {
+	if c.get("description") == "null" {
+		return
+	}
+
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+	c.commentOn(schema, quoteLiteral(c.get("description")))
+}
+
+// Drop does nothing, because db1 does not have the object, and dropping the object drops its comment
+func (c *CommentSchema) Drop() {
+}
+
+// Change handles the case where the objects match, but the comments do not
+func (c *CommentSchema) Change(obj interface{}) {
+	c2, ok := obj.(*CommentSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a CommentSchema instance", c2)
+	}
+
+	if c.get("description") != c2.get("description") {
+		if c.get("description") == "null" {
+			c.commentOn(c2.get("schema_name"), "NULL")
+		} else {
+			c.commentOn(c2.get("schema_name"), quoteLiteral(c.get("description")))
+		}
+	}
+}
+
+// CompareComments outputs SQL to make the comments on objects match between DBs or schemas
+func CompareComments(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	commentSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	commentSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(CommentRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(CommentRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &CommentSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &CommentSchema{rows: rows2, rowNum: -1}
+
+	// Compare the comments
+	DoDiff(schema1, schema2)
+}
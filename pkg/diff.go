@@ -1,6 +1,8 @@
 package pkg
 
 import (
+	"regexp"
+
 	"github.com/jiapeish/pgdiff/pgutil"
 )
 
@@ -17,6 +19,24 @@ type Schema interface {
 var DbInfo1 pgutil.DbInfo
 var DbInfo2 pgutil.DbInfo
 
+// SyncSequenceValues makes SEQUENCE emit setval() calls so db2's sequences continue where db1's are
+var SyncSequenceValues bool
+
+// RefreshMatViews makes MATVIEW emit REFRESH statements for the materialized views that db2 already has
+var RefreshMatViews bool
+
+// RolePattern limits ROLE to the roles whose names match this regular expression (nil for all roles)
+var RolePattern *regexp.Regexp
+
+// RolePasswords is how ROLE sets the passwords of the roles it creates: none, random or copy
+var RolePasswords string
+
+// RolePasswordFile is where ROLE writes the passwords it generates when RolePasswords is random
+var RolePasswordFile string
+
+// ReferencedRolesOnly limits ROLE to the roles that own, or have privileges on, objects in the compared schemas
+var ReferencedRolesOnly bool
+
 /*
  * This is a generic diff function that compares tables, columns, indexes, roles, grants, etc.
  * Different behaviors are specified the Schema implementations
@@ -0,0 +1,197 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	eventTriggerSqlTemplate = initEventTriggerSqlTemplate()
+)
+
+// Initializes the Sql template
+func initEventTriggerSqlTemplate() *template.Template {
+	sql := `
+SELECT e.evtname AS trigger_name
+    , e.evtevent AS event
+    , (SELECT string_agg(quote_literal(tag), ', ') FROM unnest(e.evttags) AS tag) AS tags
+    , e.evtfoid::regproc AS function_name
+    , e.evtenabled AS enabled
+    , pg_catalog.pg_get_userbyid(e.evtowner) AS owner
+FROM pg_catalog.pg_event_trigger e
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_event_trigger'::regclass AND d.objid = e.oid AND d.deptype = 'e')
+ORDER BY e.evtname;
+`
+	t := template.New("EventTriggerSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// EventTriggerRows definition
+// ==================================
+
+// EventTriggerRows is a sortable slice of string maps
+type EventTriggerRows []map[string]string
+
+func (slice EventTriggerRows) Len() int {
+	return len(slice)
+}
+
+func (slice EventTriggerRows) Less(i, j int) bool {
+	return slice[i]["trigger_name"] < slice[j]["trigger_name"]
+}
+
+func (slice EventTriggerRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// EventTriggerSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+//
+// EventTriggerSchema implements the Schema interface defined in pgdiff.go
+type EventTriggerSchema struct {
+	rows   EventTriggerRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *EventTriggerSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *EventTriggerSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *EventTriggerSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*EventTriggerSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs an EventTriggerSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("trigger_name"), c2.get("trigger_name"))
+	return val
+}
+
+// setEnabled prints SQL that gives the event trigger the enabled state of this one
+func (c *EventTriggerSchema) setEnabled() {
+	enable := ""
+	switch c.get("enabled") {
+	case "O":
+		enable = "ENABLE"
+	case "D":
+		enable = "DISABLE"
+	case "R":
+		enable = "ENABLE REPLICA"
+	case "A":
+		enable = "ENABLE ALWAYS"
+	default:
+		return
+	}
+	fmt.Printf("ALTER EVENT TRIGGER %s %s;\n", c.get("trigger_name"), enable)
+}
+
+// create prints SQL to create the event trigger (with its enabled state and owner)
+func (c *EventTriggerSchema) create() {
+	when := ""
+	if c.get("tags") != "null" {
+		when = fmt.Sprintf(" WHEN TAG IN (%s)", c.get("tags"))
+	}
+	fmt.Printf("CREATE EVENT TRIGGER %s ON %s%s EXECUTE FUNCTION %s();\n", c.get("trigger_name"), c.get("event"), when, c.get("function_name"))
+	if c.get("enabled") != "O" {
+		c.setEnabled()
+	}
+	fmt.Printf("ALTER EVENT TRIGGER %s OWNER TO %s;\n", c.get("trigger_name"), c.get("owner"))
+}
+
+// Add returns SQL to create the event trigger
+func (c EventTriggerSchema) Add() {
+	c.create()
+}
+
+// Drop returns SQL to drop the event trigger
+func (c EventTriggerSchema) Drop() {
+	fmt.Printf("DROP EVENT TRIGGER %s;\n", c.get("trigger_name"))
+}
+
+// Change handles the case where the event trigger names match, but the details do not
+func (c EventTriggerSchema) Change(obj interface{}) {
+	c2, ok := obj.(*EventTriggerSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs an EventTriggerSchema instance", c2)
+	}
+
+	// Only the enabled state, owner and name of an event trigger can be altered
+	if c.get("event") != c2.get("event") || c.get("tags") != c2.get("tags") || c.get("function_name") != c2.get("function_name") {
+		fmt.Println("-- This event trigger is different so we'll drop and recreate it:")
+		c2.Drop()
+		c.create()
+		return
+	}
+
+	// A different owner is handled by OWNER
+	if c.get("enabled") != c2.get("enabled") {
+		c.setEnabled()
+	}
+}
+
+// CompareEventTriggers outputs SQL to make the event triggers match between DBs
+func CompareEventTriggers(conn1 *sql.DB, conn2 *sql.DB) {
+
+	// Event triggers belong to the database, so there is nothing to compare
+	// between two schemas of the same database.
+	if DbInfo1.DbSchema != DbInfo2.DbSchema {
+		return
+	}
+
+	buf1 := new(bytes.Buffer)
+	eventTriggerSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	eventTriggerSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(EventTriggerRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(EventTriggerRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &EventTriggerSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &EventTriggerSchema{rows: rows2, rowNum: -1}
+
+	// Compare the event triggers
+	DoDiff(schema1, schema2)
+}
@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	extensionSqlTemplate = initExtensionSqlTemplate()
+)
+
+// Initializes the Sql template
+func initExtensionSqlTemplate() *template.Template {
+	sql := `
+SELECT e.extname AS extension_name
+    , n.nspname AS schema_name
+    , e.extversion AS version
+    , e.extrelocatable AS relocatable
+FROM pg_catalog.pg_extension e
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = e.extnamespace)
+{{if ne $.DbSchema "*" }}
+WHERE n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY e.extname;
+`
+	t := template.New("ExtensionSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// ExtensionRows definition
+// ==================================
+
+// ExtensionRows is a sortable slice of string maps
+type ExtensionRows []map[string]string
+
+func (slice ExtensionRows) Len() int {
+	return len(slice)
+}
+
+func (slice ExtensionRows) Less(i, j int) bool {
+	return slice[i]["extension_name"] < slice[j]["extension_name"]
+}
+
+func (slice ExtensionRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ExtensionSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+//
+// ExtensionSchema implements the Schema interface defined in pgdiff.go
+type ExtensionSchema struct {
+	rows   ExtensionRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *ExtensionSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *ExtensionSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *ExtensionSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*ExtensionSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs an ExtensionSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("extension_name"), c2.get("extension_name"))
+	return val
+}
+
+// Add returns SQL to create the extension
+func (c ExtensionSchema) Add() {
+	fmt.Printf("CREATE EXTENSION IF NOT EXISTS \"%s\" WITH SCHEMA %s VERSION '%s';\n", c.get("extension_name"), c.get("schema_name"), c.get("version"))
+}
+
+// Drop returns SQL to drop the extension
+func (c ExtensionSchema) Drop() {
+	fmt.Println("-- Note that this will fail if anything outside the extension still uses its types or functions.")
+	fmt.Printf("DROP EXTENSION \"%s\";\n", c.get("extension_name"))
+}
+
+// Change handles the case where the extension names match, but the schema or version does not
+func (c ExtensionSchema) Change(obj interface{}) {
+	c2, ok := obj.(*ExtensionSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs an ExtensionSchema instance", c2)
+	}
+
+	if c.get("schema_name") != c2.get("schema_name") {
+		if c2.get("relocatable") != "true" {
+			fmt.Printf("-- WARNING: extension %s is not relocatable, so it must be dropped and recreated to move it to schema %s.\n", c.get("extension_name"), c.get("schema_name"))
+		} else {
+			fmt.Printf("ALTER EXTENSION \"%s\" SET SCHEMA %s;\n", c.get("extension_name"), c.get("schema_name"))
+		}
+	}
+
+	if c.get("version") != c2.get("version") {
+		fmt.Printf("ALTER EXTENSION \"%s\" UPDATE TO '%s'; -- from %s\n", c.get("extension_name"), c.get("version"), c2.get("version"))
+	}
+}
+
+// CompareExtensions outputs SQL to make the installed extensions match between DBs
+func CompareExtensions(conn1 *sql.DB, conn2 *sql.DB) {
+
+	// Extensions are installed per database, so there is nothing to compare
+	// between two schemas of the same database.
+	if DbInfo1.DbSchema != DbInfo2.DbSchema {
+		return
+	}
+
+	buf1 := new(bytes.Buffer)
+	extensionSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	extensionSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(ExtensionRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(ExtensionRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &ExtensionSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &ExtensionSchema{rows: rows2, rowNum: -1}
+
+	// Compare the extensions
+	DoDiff(schema1, schema2)
+}
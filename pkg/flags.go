@@ -7,6 +7,10 @@
 package pkg
 
 import (
+	"fmt"
+	"os"
+	"regexp"
+
 	flag "github.com/jiapeish/pgdiff/pflag"
 	"github.com/jiapeish/pgdiff/pgutil"
 )
@@ -29,8 +33,29 @@ func ParseFlags() (pgutil.DbInfo, pgutil.DbInfo) {
 	var dbSchema2 = flag.StringP("schema2", "s", "*", "schema name or * for all schemas")
 	var dbOptions2 = flag.StringP("options2", "o", "", "db options (eg. sslmode=disable)")
 
+	var syncSequenceValues = flag.Bool("sync-sequence-values", false, "set the current value of db2's sequences to db1's")
+	var refreshMatViews = flag.Bool("refresh-matviews", false, "refresh db2's materialized views")
+	var rolePattern = flag.String("role-pattern", "", "only compare roles whose names match this regular expression")
+	var rolePasswords = flag.String("role-passwords", "none", "how to set the passwords of created roles: none, random or copy")
+	var rolePasswordFile = flag.String("role-password-file", "pgdiff-role-passwords.txt", "file to write generated role passwords to")
+	var referencedRoles = flag.Bool("referenced-roles", false, "only compare roles that own or have privileges on objects in the compared schemas")
+
 	flag.Parse()
 
+	SyncSequenceValues = *syncSequenceValues
+	RefreshMatViews = *refreshMatViews
+	if len(*rolePattern) > 0 {
+		pattern, err := regexp.Compile(*rolePattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --role-pattern %q: %v\n", *rolePattern, err)
+			os.Exit(1)
+		}
+		RolePattern = pattern
+	}
+	ReferencedRolesOnly = *referencedRoles
+	RolePasswords = *rolePasswords
+	RolePasswordFile = *rolePasswordFile
+
 	dbInfo1 := pgutil.DbInfo{DbName: *dbName1, DbHost: *dbHost1, DbPort: int32(*dbPort1), DbUser: *dbUser1, DbPass: *dbPass1, DbSchema: *dbSchema1, DbOptions: *dbOptions1}
 
 	dbInfo2 := pgutil.DbInfo{DbName: *dbName2, DbHost: *dbHost2, DbPort: int32(*dbPort2), DbUser: *dbUser2, DbPass: *dbPass2, DbSchema: *dbSchema2, DbOptions: *dbOptions2}
@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	foreignDataWrapperSqlTemplate = initForeignDataWrapperSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// Wrappers created by an extension (such as postgres_fdw) are compared by EXTENSION.
+func initForeignDataWrapperSqlTemplate() *template.Template {
+	sql := `
+SELECT w.fdwname AS fdw_name
+    , NULLIF(w.fdwhandler, 0)::regproc AS handler
+    , NULLIF(w.fdwvalidator, 0)::regproc AS validator
+    , array_to_string(w.fdwoptions, E'\n') AS options
+    , pg_catalog.pg_get_userbyid(w.fdwowner) AS owner
+FROM pg_catalog.pg_foreign_data_wrapper w
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_foreign_data_wrapper'::regclass AND d.objid = w.oid AND d.deptype = 'e')
+ORDER BY w.fdwname;
+`
+	t := template.New("ForeignDataWrapperSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// optionsClause returns the OPTIONS clause (with a leading space) that gives a new foreign
+// object the given options, or an empty string when there are none
+func optionsClause(options map[string]string) string {
+	if len(options) == 0 {
+		return ""
+	}
+	defs := []string{}
+	for _, name := range sortedKeys(options) {
+		defs = append(defs, fmt.Sprintf("%s %s", name, quoteLiteral(options[name])))
+	}
+	return fmt.Sprintf(" OPTIONS (%s)", strings.Join(defs, ", "))
+}
+
+// optionChanges returns the ADD, SET and DROP actions that make the foreign object options
+// in options2 match the ones in options1
+func optionChanges(options1 map[string]string, options2 map[string]string) []string {
+	actions := []string{}
+	for _, name := range sortedKeys(options1) {
+		value, ok := options2[name]
+		if !ok {
+			actions = append(actions, fmt.Sprintf("ADD %s %s", name, quoteLiteral(options1[name])))
+		} else if value != options1[name] {
+			actions = append(actions, fmt.Sprintf("SET %s %s", name, quoteLiteral(options1[name])))
+		}
+	}
+	for _, name := range sortedKeys(options2) {
+		if _, ok := options1[name]; !ok {
+			actions = append(actions, "DROP "+name)
+		}
+	}
+	return actions
+}
+
+// ==================================
+// ForeignDataWrapperRows definition
+// ==================================
+
+// ForeignDataWrapperRows is a sortable slice of string maps
+type ForeignDataWrapperRows []map[string]string
+
+func (slice ForeignDataWrapperRows) Len() int {
+	return len(slice)
+}
+
+func (slice ForeignDataWrapperRows) Less(i, j int) bool {
+	return slice[i]["fdw_name"] < slice[j]["fdw_name"]
+}
+
+func (slice ForeignDataWrapperRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ForeignDataWrapperSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+//
+// ForeignDataWrapperSchema implements the Schema interface defined in pgdiff.go
+type ForeignDataWrapperSchema struct {
+	rows   ForeignDataWrapperRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *ForeignDataWrapperSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *ForeignDataWrapperSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *ForeignDataWrapperSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*ForeignDataWrapperSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a ForeignDataWrapperSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("fdw_name"), c2.get("fdw_name"))
+	return val
+}
+
+// Add returns SQL to create the foreign-data wrapper
+func (c ForeignDataWrapperSchema) Add() {
+	handler := ""
+	if c.get("handler") != "null" {
+		handler = " HANDLER " + c.get("handler")
+	}
+	validator := ""
+	if c.get("validator") != "null" {
+		validator = " VALIDATOR " + c.get("validator")
+	}
+	fmt.Printf("CREATE FOREIGN DATA WRAPPER %s%s%s%s;\n", c.get("fdw_name"), handler, validator, optionsClause(parseConfig(c.get("options"))))
+	fmt.Printf("ALTER FOREIGN DATA WRAPPER %s OWNER TO %s;\n", c.get("fdw_name"), c.get("owner"))
+}
+
+// Drop returns SQL to drop the foreign-data wrapper, along with the servers, user mappings
+// and foreign tables that use it (none of which db1 can have)
+func (c ForeignDataWrapperSchema) Drop() {
+	fmt.Printf("DROP FOREIGN DATA WRAPPER %s CASCADE;\n", c.get("fdw_name"))
+}
+
+// Change handles the case where the wrapper names match, but the details do not
+func (c ForeignDataWrapperSchema) Change(obj interface{}) {
+	c2, ok := obj.(*ForeignDataWrapperSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a ForeignDataWrapperSchema instance", c2)
+	}
+
+	if c.get("handler") != c2.get("handler") {
+		if c.get("handler") == "null" {
+			fmt.Printf("ALTER FOREIGN DATA WRAPPER %s NO HANDLER;\n", c2.get("fdw_name"))
+		} else {
+			fmt.Printf("ALTER FOREIGN DATA WRAPPER %s HANDLER %s;\n", c2.get("fdw_name"), c.get("handler"))
+		}
+	}
+	if c.get("validator") != c2.get("validator") {
+		if c.get("validator") == "null" {
+			fmt.Printf("ALTER FOREIGN DATA WRAPPER %s NO VALIDATOR;\n", c2.get("fdw_name"))
+		} else {
+			fmt.Printf("ALTER FOREIGN DATA WRAPPER %s VALIDATOR %s;\n", c2.get("fdw_name"), c.get("validator"))
+		}
+	}
+
+	// A different owner is handled by OWNER
+	actions := optionChanges(parseConfig(c.get("options")), parseConfig(c2.get("options")))
+	if len(actions) > 0 {
+		fmt.Printf("ALTER FOREIGN DATA WRAPPER %s OPTIONS (%s);\n", c2.get("fdw_name"), strings.Join(actions, ", "))
+	}
+}
+
+// CompareForeignDataWrappers outputs SQL to make the foreign-data wrappers match between DBs
+func CompareForeignDataWrappers(conn1 *sql.DB, conn2 *sql.DB) {
+
+	// Foreign-data wrappers belong to the database, so there is nothing to compare
+	// between two schemas of the same database.
+	if DbInfo1.DbSchema != DbInfo2.DbSchema {
+		return
+	}
+
+	buf1 := new(bytes.Buffer)
+	foreignDataWrapperSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	foreignDataWrapperSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(ForeignDataWrapperRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(ForeignDataWrapperRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &ForeignDataWrapperSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &ForeignDataWrapperSchema{rows: rows2, rowNum: -1}
+
+	// Compare the foreign-data wrappers
+	DoDiff(schema1, schema2)
+}
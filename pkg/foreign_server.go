@@ -0,0 +1,193 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	foreignServerSqlTemplate = initForeignServerSqlTemplate()
+)
+
+// Initializes the Sql template
+func initForeignServerSqlTemplate() *template.Template {
+	sql := `
+SELECT s.srvname AS server_name
+    , w.fdwname AS fdw_name
+    , s.srvtype AS server_type
+    , s.srvversion AS server_version
+    , array_to_string(s.srvoptions, E'\n') AS options
+    , pg_catalog.pg_get_userbyid(s.srvowner) AS owner
+FROM pg_catalog.pg_foreign_server s
+INNER JOIN pg_catalog.pg_foreign_data_wrapper w ON (w.oid = s.srvfdw)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_foreign_server'::regclass AND d.objid = s.oid AND d.deptype = 'e')
+ORDER BY s.srvname;
+`
+	t := template.New("ForeignServerSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// ForeignServerRows definition
+// ==================================
+
+// ForeignServerRows is a sortable slice of string maps
+type ForeignServerRows []map[string]string
+
+func (slice ForeignServerRows) Len() int {
+	return len(slice)
+}
+
+func (slice ForeignServerRows) Less(i, j int) bool {
+	return slice[i]["server_name"] < slice[j]["server_name"]
+}
+
+func (slice ForeignServerRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ForeignServerSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+//
+// ForeignServerSchema implements the Schema interface defined in pgdiff.go
+type ForeignServerSchema struct {
+	rows   ForeignServerRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *ForeignServerSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *ForeignServerSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *ForeignServerSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*ForeignServerSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a ForeignServerSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("server_name"), c2.get("server_name"))
+	return val
+}
+
+// create prints SQL to create the foreign server (with its owner)
+func (c *ForeignServerSchema) create() {
+	serverType := ""
+	if c.get("server_type") != "null" {
+		serverType = " TYPE " + quoteLiteral(c.get("server_type"))
+	}
+	version := ""
+	if c.get("server_version") != "null" {
+		version = " VERSION " + quoteLiteral(c.get("server_version"))
+	}
+	fmt.Printf("CREATE SERVER %s%s%s FOREIGN DATA WRAPPER %s%s;\n", c.get("server_name"), serverType, version, c.get("fdw_name"), optionsClause(parseConfig(c.get("options"))))
+	fmt.Printf("ALTER SERVER %s OWNER TO %s;\n", c.get("server_name"), c.get("owner"))
+}
+
+// Add returns SQL to create the foreign server
+func (c ForeignServerSchema) Add() {
+	c.create()
+}
+
+// Drop returns SQL to drop the foreign server, along with the user mappings and foreign
+// tables that use it (none of which db1 can have)
+func (c ForeignServerSchema) Drop() {
+	fmt.Printf("DROP SERVER %s CASCADE;\n", c.get("server_name"))
+}
+
+// Change handles the case where the server names match, but the details do not
+func (c ForeignServerSchema) Change(obj interface{}) {
+	c2, ok := obj.(*ForeignServerSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a ForeignServerSchema instance", c2)
+	}
+
+	// The wrapper and type of a server cannot be altered
+	if c.get("fdw_name") != c2.get("fdw_name") || c.get("server_type") != c2.get("server_type") {
+		fmt.Println("-- This server is different so we'll drop and recreate it:")
+		fmt.Println("-- WARNING: this drops the server's user mappings and foreign tables.  Re-run pgdiff with the USER_MAPPING and FOREIGN_TABLE options afterwards.")
+		c2.Drop()
+		c.create()
+		return
+	}
+
+	if c.get("server_version") != c2.get("server_version") {
+		if c.get("server_version") == "null" {
+			fmt.Printf("ALTER SERVER %s VERSION NULL;\n", c2.get("server_name"))
+		} else {
+			fmt.Printf("ALTER SERVER %s VERSION %s;\n", c2.get("server_name"), quoteLiteral(c.get("server_version")))
+		}
+	}
+
+	// A different owner is handled by OWNER
+	actions := optionChanges(parseConfig(c.get("options")), parseConfig(c2.get("options")))
+	if len(actions) > 0 {
+		fmt.Printf("ALTER SERVER %s OPTIONS (%s);\n", c2.get("server_name"), strings.Join(actions, ", "))
+	}
+}
+
+// CompareForeignServers outputs SQL to make the foreign servers match between DBs
+func CompareForeignServers(conn1 *sql.DB, conn2 *sql.DB) {
+
+	// Foreign servers belong to the database, so there is nothing to compare
+	// between two schemas of the same database.
+	if DbInfo1.DbSchema != DbInfo2.DbSchema {
+		return
+	}
+
+	buf1 := new(bytes.Buffer)
+	foreignServerSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	foreignServerSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(ForeignServerRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(ForeignServerRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &ForeignServerSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &ForeignServerSchema{rows: rows2, rowNum: -1}
+
+	// Compare the foreign servers
+	DoDiff(schema1, schema2)
+}
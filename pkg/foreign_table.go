@@ -0,0 +1,336 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	foreignTableSqlTemplate = initForeignTableSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// columns has one line per column: the name, type, not-null flag and column options
+// (name=value), all separated by tabs.  checks has one line per (local) check constraint:
+// the name and definition, separated by a tab.  Foreign tables that are partitions are
+// created as a partition of their parent, from which they get their columns.
+func initForeignTableSqlTemplate() *template.Template {
+	sql := `
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS compare_name
+    , c.relname AS table_name
+    , s.srvname AS server_name
+    , array_to_string(ft.ftoptions, E'\n') AS options
+    , (SELECT string_agg(quote_ident(a.attname) || E'\t' || pg_catalog.format_type(a.atttypid, a.atttypmod)
+            || E'\t' || a.attnotnull || COALESCE(E'\t' || array_to_string(a.attfdwoptions, E'\t'), ''), E'\n' ORDER BY a.attnum)
+       FROM pg_catalog.pg_attribute a
+       WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped) AS columns
+    , (SELECT string_agg(con.conname || E'\t' || pg_catalog.pg_get_constraintdef(con.oid, true), E'\n' ORDER BY con.conname)
+       FROM pg_catalog.pg_constraint con
+       WHERE con.conrelid = c.oid AND con.contype = 'c' AND con.conislocal) AS checks
+    , pn.nspname AS parent_schema
+    , pc.relname AS parent_name
+    , pg_catalog.pg_get_expr(c.relpartbound, c.oid) AS partition_bound
+FROM pg_catalog.pg_foreign_table ft
+INNER JOIN pg_catalog.pg_class c ON (c.oid = ft.ftrelid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+INNER JOIN pg_catalog.pg_foreign_server s ON (s.oid = ft.ftserver)
+LEFT OUTER JOIN pg_catalog.pg_inherits i ON (i.inhrelid = c.oid AND c.relispartition)
+LEFT OUTER JOIN pg_catalog.pg_class pc ON (pc.oid = i.inhparent)
+LEFT OUTER JOIN pg_catalog.pg_namespace pn ON (pn.oid = pc.relnamespace)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name;
+`
+	t := template.New("ForeignTableSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// foreignColumn is one column of a foreign table
+type foreignColumn struct {
+	name     string
+	dataType string
+	notNull  bool
+	options  map[string]string
+}
+
+// definition returns the column as it is written in CREATE FOREIGN TABLE and ADD COLUMN
+func (col foreignColumn) definition() string {
+	def := col.name + " " + col.dataType + optionsClause(col.options)
+	if col.notNull {
+		def += " NOT NULL"
+	}
+	return def
+}
+
+// parseForeignColumns converts the columns of a foreign table (as selected by the sql
+// template) into a slice of columns in table order
+func parseForeignColumns(columns string) []foreignColumn {
+	cols := []foreignColumn{}
+	if columns == "null" || len(columns) == 0 {
+		return cols
+	}
+	for _, line := range strings.Split(columns, "\n") {
+		parts := strings.Split(line, "\t")
+		if len(parts) < 3 {
+			continue
+		}
+		col := foreignColumn{name: parts[0], dataType: parts[1], notNull: parts[2] == "true", options: make(map[string]string)}
+		for _, option := range parts[3:] {
+			nameValue := strings.SplitN(option, "=", 2)
+			if len(nameValue) == 2 {
+				col.options[nameValue[0]] = nameValue[1]
+			}
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// parseForeignChecks converts the check constraints of a foreign table (as selected by the
+// sql template) into a map of constraint name to definition
+func parseForeignChecks(checks string) map[string]string {
+	defs := make(map[string]string)
+	if checks == "null" || len(checks) == 0 {
+		return defs
+	}
+	for _, line := range strings.Split(checks, "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) == 2 {
+			defs[parts[0]] = parts[1]
+		}
+	}
+	return defs
+}
+
+// ==================================
+// ForeignTableRows definition
+// ==================================
+
+// ForeignTableRows is a sortable slice of string maps
+type ForeignTableRows []map[string]string
+
+func (slice ForeignTableRows) Len() int {
+	return len(slice)
+}
+
+func (slice ForeignTableRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice ForeignTableRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ForeignTableSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+//
+// ForeignTableSchema implements the Schema interface defined in pgdiff.go
+type ForeignTableSchema struct {
+	rows   ForeignTableRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *ForeignTableSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *ForeignTableSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *ForeignTableSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*ForeignTableSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a ForeignTableSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// create prints SQL to create the foreign table in the given schema
+func (c *ForeignTableSchema) create(schema string) {
+	options := optionsClause(parseConfig(c.get("options")))
+	checks := parseForeignChecks(c.get("checks"))
+	checkDefs := []string{}
+	for _, name := range sortedKeys(checks) {
+		checkDefs = append(checkDefs, fmt.Sprintf("CONSTRAINT %s %s", name, checks[name]))
+	}
+
+	if c.get("parent_name") != "null" {
+		parentSchema := c.get("parent_schema")
+		if DbInfo1.DbSchema != DbInfo2.DbSchema && parentSchema == DbInfo1.DbSchema {
+			parentSchema = DbInfo2.DbSchema
+		}
+		constraints := ""
+		if len(checkDefs) > 0 {
+			constraints = fmt.Sprintf(" (\n    %s\n)", strings.Join(checkDefs, ",\n    "))
+		}
+		fmt.Printf("CREATE FOREIGN TABLE %s.%s PARTITION OF %s.%s%s %s SERVER %s%s;\n", schema, c.get("table_name"), parentSchema, c.get("parent_name"), constraints, c.get("partition_bound"), c.get("server_name"), options)
+		return
+	}
+
+	defs := []string{}
+	for _, col := range parseForeignColumns(c.get("columns")) {
+		defs = append(defs, col.definition())
+	}
+	defs = append(defs, checkDefs...)
+	fmt.Printf("CREATE FOREIGN TABLE %s.%s (\n    %s\n) SERVER %s%s;\n", schema, c.get("table_name"), strings.Join(defs, ",\n    "), c.get("server_name"), options)
+}
+
+// Add returns SQL to create the foreign table
+func (c ForeignTableSchema) Add() {
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+	c.create(schema)
+}
+
+// Drop returns SQL to drop the foreign table
+func (c ForeignTableSchema) Drop() {
+	fmt.Printf("DROP FOREIGN TABLE %s.%s;\n", c.get("schema_name"), c.get("table_name"))
+}
+
+// Change handles the case where the foreign table names match, but the server, options,
+// columns or check constraints do not
+func (c ForeignTableSchema) Change(obj interface{}) {
+	c2, ok := obj.(*ForeignTableSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a ForeignTableSchema instance", c2)
+	}
+
+	name := fmt.Sprintf("%s.%s", c2.get("schema_name"), c2.get("table_name"))
+
+	// The server of a foreign table cannot be altered, and neither can the parent it is a partition of
+	if c.get("server_name") != c2.get("server_name") || c.get("parent_name") != c2.get("parent_name") || c.get("partition_bound") != c2.get("partition_bound") {
+		fmt.Println("-- This foreign table is different so we'll drop and recreate it:")
+		c2.Drop()
+		c.create(c2.get("schema_name"))
+		return
+	}
+
+	actions := []string{}
+	if changes := optionChanges(parseConfig(c.get("options")), parseConfig(c2.get("options"))); len(changes) > 0 {
+		actions = append(actions, fmt.Sprintf("OPTIONS (%s)", strings.Join(changes, ", ")))
+	}
+
+	// Check constraints are not enforced on foreign tables, so a different one is simply replaced.
+	// They are dropped before any column they use, and added after any column they use.
+	checks1 := parseForeignChecks(c.get("checks"))
+	checks2 := parseForeignChecks(c2.get("checks"))
+	for _, checkName := range sortedKeys(checks2) {
+		if def, ok := checks1[checkName]; !ok || def != checks2[checkName] {
+			actions = append(actions, "DROP CONSTRAINT "+checkName)
+		}
+	}
+
+	cols2 := make(map[string]foreignColumn)
+	for _, col := range parseForeignColumns(c2.get("columns")) {
+		cols2[col.name] = col
+	}
+	cols1 := make(map[string]bool)
+	for _, col := range parseForeignColumns(c.get("columns")) {
+		cols1[col.name] = true
+		col2, ok := cols2[col.name]
+		if !ok {
+			// Partitions get their columns from the parent
+			if c.get("parent_name") == "null" {
+				actions = append(actions, "ADD COLUMN "+col.definition())
+			}
+			continue
+		}
+		if col.dataType != col2.dataType {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s TYPE %s", col.name, col.dataType))
+		}
+		if col.notNull && !col2.notNull {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", col.name))
+		} else if !col.notNull && col2.notNull {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", col.name))
+		}
+		if changes := optionChanges(col.options, col2.options); len(changes) > 0 {
+			actions = append(actions, fmt.Sprintf("ALTER COLUMN %s OPTIONS (%s)", col.name, strings.Join(changes, ", ")))
+		}
+	}
+	if c.get("parent_name") == "null" {
+		for _, col := range parseForeignColumns(c2.get("columns")) {
+			if !cols1[col.name] {
+				actions = append(actions, "DROP COLUMN "+col.name)
+			}
+		}
+	}
+
+	for _, checkName := range sortedKeys(checks1) {
+		if def, ok := checks2[checkName]; !ok || def != checks1[checkName] {
+			actions = append(actions, fmt.Sprintf("ADD CONSTRAINT %s %s", checkName, checks1[checkName]))
+		}
+	}
+
+	if len(actions) > 0 {
+		fmt.Printf("ALTER FOREIGN TABLE %s %s;\n", name, strings.Join(actions, ", "))
+	}
+}
+
+// CompareForeignTables outputs SQL to make the foreign tables (and their columns) match between DBs or schemas
+func CompareForeignTables(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	foreignTableSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	foreignTableSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(ForeignTableRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(ForeignTableRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &ForeignTableSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &ForeignTableSchema{rows: rows2, rowNum: -1}
+
+	// Compare the foreign tables
+	DoDiff(schema1, schema2)
+}
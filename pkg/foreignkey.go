@@ -32,6 +32,8 @@ FROM pg_catalog.pg_constraint c
 INNER JOIN pg_class AS cl ON (c.conrelid = cl.oid)
 INNER JOIN pg_namespace AS ns ON (ns.oid = c.connamespace)
 WHERE c.contype = 'f'
+AND c.conparentid = 0 -- partition foreign keys come with the partitioned table's foreign key
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = cl.oid AND d.deptype = 'e')
 {{if eq $.DbSchema "*"}}
 AND ns.nspname NOT LIKE 'pg_%' 
 AND ns.nspname <> 'information_schema' 
@@ -22,19 +22,75 @@ var (
 )
 
 // Initializes the Sql template
+//
+// pg_get_functiondef does not work for aggregates, so their definition is built from pg_aggregate.
+// grants is null when proacl is (so the function has the default privileges).
 func initFunctionSqlTemplate() *template.Template {
 	sql := `
     SELECT n.nspname                 AS schema_name
-        , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}p.proname AS compare_name
+        , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}p.proname || '(' || pg_catalog.oidvectortypes(p.proargtypes) || ')' AS compare_name
         , p.proname                  AS function_name
+        , CASE p.prokind
+          WHEN 'p' THEN 'PROCEDURE'
+          WHEN 'a' THEN 'AGGREGATE'
+          ELSE 'FUNCTION' END        AS function_type
+        , CASE WHEN p.prokind = 'a'
+          THEN p.proname || '(' || COALESCE(NULLIF(pg_catalog.pg_get_function_identity_arguments(p.oid), ''), '*') || ')'
+          ELSE p.proname || '(' || pg_catalog.oidvectortypes(p.proargtypes) || ')' END AS signature
         , p.oid::regprocedure        AS fancy
-        , t.typname                  AS return_type
-        , pg_get_functiondef(p.oid)  AS definition
+        , pg_catalog.pg_get_function_identity_arguments(p.oid) AS identity_args
+        , pg_catalog.pg_get_function_result(p.oid) AS return_type
+        , CASE p.provolatile
+          WHEN 'i' THEN 'IMMUTABLE'
+          WHEN 's' THEN 'STABLE'
+          ELSE 'VOLATILE' END        AS volatility
+        , p.proisstrict              AS strict
+        , p.prosecdef                AS security_definer
+        , p.proleakproof             AS leakproof
+        , p.procost                  AS cost
+        , p.proretset                AS returns_set
+        , p.prorows                  AS rows
+        , CASE p.proparallel
+          WHEN 's' THEN 'SAFE'
+          WHEN 'r' THEN 'RESTRICTED'
+          ELSE 'UNSAFE' END          AS parallel
+        , array_to_string(p.proconfig, E'\n') AS config
+        , pg_catalog.pg_get_userbyid(p.proowner) AS owner
+        , pg_catalog.oidvectortypes(p.proargtypes) AS arg_types
+        , CASE WHEN p.proacl IS NOT NULL THEN
+            COALESCE((SELECT string_agg('EXECUTE TO ' || CASE WHEN acl.grantee = 0 THEN 'PUBLIC' ELSE quote_ident(pg_catalog.pg_get_userbyid(acl.grantee)) END
+                                        || CASE WHEN acl.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END, E'\n' ORDER BY acl.grantee)
+                      FROM aclexplode(p.proacl) AS acl
+                      WHERE acl.grantee <> p.proowner), '')
+          END AS grants
+        , CASE WHEN p.prokind = 'a' THEN
+            'CREATE AGGREGATE ' || n.nspname || '.' || p.proname || '(' || COALESCE(NULLIF(pg_catalog.pg_get_function_identity_arguments(p.oid), ''), '*') || ') ('
+            || E'\n    SFUNC = ' || agg.aggtransfn::regproc
+            || E',\n    STYPE = ' || pg_catalog.format_type(agg.aggtranstype, NULL)
+            || CASE WHEN agg.aggtransspace <> 0 THEN E',\n    SSPACE = ' || agg.aggtransspace ELSE '' END
+            || CASE WHEN agg.aggfinalfn <> 0 THEN E',\n    FINALFUNC = ' || agg.aggfinalfn::regproc ELSE '' END
+            || CASE WHEN agg.aggfinalextra THEN E',\n    FINALFUNC_EXTRA' ELSE '' END
+            || CASE WHEN agg.aggcombinefn <> 0 THEN E',\n    COMBINEFUNC = ' || agg.aggcombinefn::regproc ELSE '' END
+            || CASE WHEN agg.aggserialfn <> 0 THEN E',\n    SERIALFUNC = ' || agg.aggserialfn::regproc ELSE '' END
+            || CASE WHEN agg.aggdeserialfn <> 0 THEN E',\n    DESERIALFUNC = ' || agg.aggdeserialfn::regproc ELSE '' END
+            || CASE WHEN agg.agginitval IS NOT NULL THEN E',\n    INITCOND = ' || quote_literal(agg.agginitval) ELSE '' END
+            || CASE WHEN agg.aggmtransfn <> 0 THEN E',\n    MSFUNC = ' || agg.aggmtransfn::regproc
+                || E',\n    MINVFUNC = ' || agg.aggminvtransfn::regproc
+                || E',\n    MSTYPE = ' || pg_catalog.format_type(agg.aggmtranstype, NULL) ELSE '' END
+            || CASE WHEN agg.aggmfinalfn <> 0 THEN E',\n    MFINALFUNC = ' || agg.aggmfinalfn::regproc ELSE '' END
+            || CASE WHEN agg.aggmfinalextra THEN E',\n    MFINALFUNC_EXTRA' ELSE '' END
+            || CASE WHEN agg.aggminitval IS NOT NULL THEN E',\n    MINITCOND = ' || quote_literal(agg.aggminitval) ELSE '' END
+            || CASE WHEN agg.aggsortop <> 0 THEN E',\n    SORTOP = ' || agg.aggsortop::regoper ELSE '' END
+            || CASE WHEN agg.aggkind = 'h' THEN E',\n    HYPOTHETICAL' ELSE '' END
+            || CASE p.proparallel WHEN 's' THEN E',\n    PARALLEL = SAFE' WHEN 'r' THEN E',\n    PARALLEL = RESTRICTED' ELSE '' END
+            || E'\n)'
+          ELSE pg_get_functiondef(p.oid) END AS definition
     FROM pg_proc AS p
-    JOIN pg_type t ON (p.prorettype = t.oid)
     JOIN pg_namespace n ON (n.oid = p.pronamespace)
-    JOIN pg_language l ON (p.prolang = l.oid AND l.lanname IN ('c','plpgsql', 'sql'))
+    JOIN pg_language l ON (p.prolang = l.oid)
+    LEFT JOIN pg_aggregate agg ON (agg.aggfnoid = p.oid)
     WHERE true
+    AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')
 	{{if eq $.DbSchema "*" }}
     AND n.nspname NOT LIKE 'pg_%' 
     AND n.nspname <> 'information_schema' 
@@ -106,56 +162,238 @@ func (c *FunctionSchema) Compare(obj interface{}) int {
 	return val
 }
 
-// Add returns SQL to create the function
-func (c FunctionSchema) Add() {
-	// If we are comparing two different schemas against each other, we need to do some
-	// modification of the first function definition so we create it in the right schema
+// definitionForSchema returns the function definition, modified (if we are comparing
+// two different schemas against each other) so that it creates the function in the right schema
+func (c FunctionSchema) definitionForSchema() string {
 	functionDef := c.get("definition")
 	if DbInfo1.DbSchema != DbInfo2.DbSchema {
 		functionDef = strings.Replace(
 			functionDef,
-			fmt.Sprintf("FUNCTION %s.%s(", c.get("schema_name"), c.get("function_name")),
-			fmt.Sprintf("FUNCTION %s.%s(", DbInfo2.DbSchema, c.get("function_name")),
+			fmt.Sprintf("%s %s.%s(", c.get("function_type"), c.get("schema_name"), c.get("function_name")),
+			fmt.Sprintf("%s %s.%s(", c.get("function_type"), DbInfo2.DbSchema, c.get("function_name")),
 			-1)
 	}
+	return functionDef
+}
 
+// Add returns SQL to create the function, procedure or aggregate
+func (c FunctionSchema) Add() {
 	fmt.Println("-- STATEMENT-BEGIN")
-	fmt.Println(functionDef, ";")
+	fmt.Println(c.definitionForSchema(), ";")
 	fmt.Println("-- STATEMENT-END")
 }
 
-// Drop returns SQL to drop the function
+// printGrants prints SQL that gives a recreated function the grants in this row.  A new
+// function can be executed by PUBLIC, so that is revoked first unless it has the default privileges.
+func (c FunctionSchema) printGrants(schema string) {
+	if c.get("grants") == "null" {
+		return
+	}
+	// Aggregates are granted like functions
+	functionType := "FUNCTION"
+	if c.get("function_type") == "PROCEDURE" {
+		functionType = "PROCEDURE"
+	}
+	name := fmt.Sprintf("%s %s.%s(%s)", functionType, schema, c.get("function_name"), c.get("arg_types"))
+	fmt.Printf("REVOKE ALL ON %s FROM PUBLIC;\n", name)
+	if len(c.get("grants")) == 0 {
+		return
+	}
+	for _, grant := range strings.Split(c.get("grants"), "\n") {
+		parts := strings.SplitN(grant, " TO ", 2)
+		if len(parts) == 2 {
+			fmt.Printf("GRANT %s ON %s TO %s;\n", parts[0], name, parts[1])
+		}
+	}
+}
+
+// Drop returns SQL to drop the function, procedure or aggregate
 func (c FunctionSchema) Drop() {
 	fmt.Println("-- Note that CASCADE in the statement below will also drop any triggers depending on this function.")
-	fmt.Println("-- Also, if there are two functions with this name, you will want to add arguments to identify the correct one to drop.")
-	fmt.Println("-- (See http://www.postgresql.org/docs/9.4/interactive/sql-dropfunction.html) ")
-	fmt.Printf("DROP FUNCTION %s.%s CASCADE;\n", c.get("schema_name"), c.get("function_name"))
+	fmt.Printf("DROP %s %s.%s CASCADE;\n", c.get("function_type"), c.get("schema_name"), c.get("signature"))
+}
+
+// parseConfig converts configuration parameters (name=value lines, or null) into a map of name to value
+func parseConfig(settings string) map[string]string {
+	config := make(map[string]string)
+	if settings == "null" || len(settings) == 0 {
+		return config
+	}
+	for _, setting := range strings.Split(settings, "\n") {
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) == 2 {
+			config[parts[0]] = parts[1]
+		}
+	}
+	return config
+}
+
+// configChanges returns the SET and RESET actions that make the configuration parameters in config2
+// match the ones in config1
+func configChanges(config1 map[string]string, config2 map[string]string) []string {
+	actions := []string{}
+	names := make([]string, 0, len(config1))
+	for name := range config1 {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value, ok := config2[name]; !ok || value != config1[name] {
+			// search_path is a list, and the list is stored already quoted
+			if name == "search_path" {
+				actions = append(actions, fmt.Sprintf("SET %s TO %s", name, config1[name]))
+			} else {
+				actions = append(actions, fmt.Sprintf("SET %s TO %s", name, quoteLiteral(config1[name])))
+			}
+		}
+	}
+	names = names[:0]
+	for name := range config2 {
+		if _, ok := config1[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		actions = append(actions, "RESET "+name)
+	}
+	return actions
+}
+
+// attributeChanges returns the ALTER FUNCTION (or PROCEDURE) actions that make c2's attributes
+// match this function's attributes.  Procedures only have the SECURITY and SET attributes.
+func (c FunctionSchema) attributeChanges(c2 *FunctionSchema) []string {
+	actions := []string{}
+
+	if c.get("function_type") == "FUNCTION" {
+		if c.get("volatility") != c2.get("volatility") {
+			actions = append(actions, c.get("volatility"))
+		}
+		if c.get("strict") != c2.get("strict") {
+			if c.get("strict") == "true" {
+				actions = append(actions, "STRICT")
+			} else {
+				actions = append(actions, "CALLED ON NULL INPUT")
+			}
+		}
+		if c.get("leakproof") != c2.get("leakproof") {
+			if c.get("leakproof") == "true" {
+				actions = append(actions, "LEAKPROOF")
+			} else {
+				actions = append(actions, "NOT LEAKPROOF")
+			}
+		}
+		if c.get("cost") != c2.get("cost") {
+			actions = append(actions, "COST "+c.get("cost"))
+		}
+		if c.get("returns_set") == "true" && c.get("rows") != c2.get("rows") {
+			actions = append(actions, "ROWS "+c.get("rows"))
+		}
+		if c.get("parallel") != c2.get("parallel") {
+			actions = append(actions, "PARALLEL "+c.get("parallel"))
+		}
+	}
+
+	if c.get("security_definer") != c2.get("security_definer") {
+		if c.get("security_definer") == "true" {
+			actions = append(actions, "SECURITY DEFINER")
+		} else {
+			actions = append(actions, "SECURITY INVOKER")
+		}
+	}
+
+	actions = append(actions, configChanges(parseConfig(c.get("config")), parseConfig(c2.get("config")))...)
+
+	return actions
 }
 
-// Change handles the case where the function names match, but the definition does not
+// withoutAttributes returns a function definition (as pg_get_functiondef prints it) without the
+// attributes that attributeChanges compares, so that everything else can be compared.  The
+// attributes are on the lines between the LANGUAGE line and the body, which is the first line
+// that does not start with a space.
+func withoutAttributes(definition string) string {
+	lines := []string{}
+	inBody := false
+	for i, line := range strings.Split(definition, "\n") {
+		if inBody || i == 0 {
+			lines = append(lines, line)
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			inBody = true
+			lines = append(lines, line)
+			continue
+		}
+		if strings.HasPrefix(line, " SET ") {
+			continue
+		}
+		if strings.HasPrefix(line, " RETURNS ") || strings.HasPrefix(line, " LANGUAGE ") || strings.HasPrefix(line, " TRANSFORM ") {
+			lines = append(lines, line)
+			continue
+		}
+
+		// The line of options, such as " WINDOW IMMUTABLE STRICT COST 10 SUPPORT s.f".  WINDOW
+		// and SUPPORT cannot be altered, so they are kept.
+		options := []string{}
+		words := strings.Fields(line)
+		for j := 0; j < len(words); j++ {
+			switch words[j] {
+			case "IMMUTABLE", "STABLE", "VOLATILE", "STRICT", "LEAKPROOF":
+			case "SECURITY", "COST", "ROWS", "PARALLEL":
+				j++
+			default:
+				options = append(options, words[j])
+			}
+		}
+		if len(options) > 0 {
+			lines = append(lines, " "+strings.Join(options, " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Change handles the case where the function signatures match, but the definition does not
 func (c FunctionSchema) Change(obj interface{}) {
 	c2, ok := obj.(*FunctionSchema)
 	if !ok {
 		fmt.Println("Error!!!, Change needs a FunctionSchema instance", c2)
 	}
-	if c.get("definition") != c2.get("definition") {
-		fmt.Println("-- This function is different so we'll recreate it:")
 
-		// If we are comparing two different schemas against each other, we need to do some
-		// modification of the first function definition so we create it in the right schema
-		functionDef := c.get("definition")
-		if DbInfo1.DbSchema != DbInfo2.DbSchema {
-			functionDef = strings.Replace(
-				functionDef,
-				fmt.Sprintf("FUNCTION %s.%s(", c.get("schema_name"), c.get("function_name")),
-				fmt.Sprintf("FUNCTION %s.%s(", DbInfo2.DbSchema, c.get("function_name")),
-				-1)
+	functionName := fmt.Sprintf("%s %s.%s", c2.get("function_type"), c2.get("schema_name"), c2.get("signature"))
+
+	if c.definitionForSchema() != c2.get("definition") {
+		// CREATE OR REPLACE cannot change the kind or return type (including OUT parameters)
+		// or rename the parameters, and aggregates cannot be replaced at all, so the old
+		// one has to be dropped first
+		if c.get("function_type") != c2.get("function_type") || c.get("function_type") == "AGGREGATE" ||
+			c.get("return_type") != c2.get("return_type") || c.get("identity_args") != c2.get("identity_args") {
+			fmt.Printf("-- This %s's kind, return type or parameters are different (%s to %s) so we'll drop and recreate it.\n",
+				strings.ToLower(c2.get("function_type")), c2.get("return_type"), c.get("return_type"))
+			fmt.Println("-- Note that this will fail if views or triggers depend on it.")
+			fmt.Printf("DROP %s;\n", functionName)
+			c.Add()
+			fmt.Printf("ALTER %s %s.%s OWNER TO %s;\n", c.get("function_type"), c2.get("schema_name"), c.get("signature"), c.get("owner"))
+			c.printGrants(c2.get("schema_name"))
+			return
+		}
+
+		// When only attributes are different, altering them leaves grants and dependent objects alone
+		actions := c.attributeChanges(c2)
+		if len(actions) > 0 && withoutAttributes(c.definitionForSchema()) == withoutAttributes(c2.get("definition")) {
+			fmt.Printf("ALTER %s %s;\n", functionName, strings.Join(actions, " "))
+		} else {
+			fmt.Printf("-- This %s is different so we'll recreate it:\n", strings.ToLower(c.get("function_type")))
+
+			// The definition column has everything needed to rebuild the function
+			fmt.Println("-- STATEMENT-BEGIN")
+			fmt.Printf("%s;\n", c.definitionForSchema())
+			fmt.Println("-- STATEMENT-END")
 		}
+	}
 
-		// The definition column has everything needed to rebuild the function
-		fmt.Println("-- STATEMENT-BEGIN")
-		fmt.Printf("%s;\n", functionDef)
-		fmt.Println("-- STATEMENT-END")
+	// Replacing a function keeps its owner, so a different owner is an attribute change too
+	if c.get("owner") != c2.get("owner") {
+		fmt.Printf("ALTER %s OWNER TO %s;\n", functionName, c.get("owner"))
 	}
 }
 
@@ -40,6 +40,9 @@ LEFT OUTER JOIN pg_catalog.pg_constraint con
     ON (con.conrelid = i.indrelid AND con.conindid = i.indexrelid AND con.contype IN ('p','u','x'))
 INNER JOIN pg_catalog.pg_namespace AS n ON (c2.relnamespace = n.oid)
 WHERE true
+AND NOT c2.relispartition -- partition indexes come with the index on the partitioned table
+AND c.relkind <> 'm' -- materialized view indexes are compared by MATVIEW
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
 {{if eq $.DbSchema "*"}}
 AND n.nspname NOT LIKE 'pg_%' 
 AND n.nspname <> 'information_schema' 
@@ -135,6 +138,11 @@ func (c *IndexSchema) Add() {
 		schema = c.get("schema_name")
 	}
 
+	// Primary key and unique constraints were already defined in the CREATE TABLE statement
+	if (c.get("typ") == "p" || c.get("typ") == "u") && isCreatedTable(c.get("schema_name"), c.get("table_name")) {
+		return
+	}
+
 	// Assertion
 	if c.get("index_def") == "null" || len(c.get("index_def")) == 0 {
 		fmt.Printf("-- Add Unexpected situation in index.go: there is no index_def for %s.%s %s\n", schema, c.get("table_name"), c.get("index_name"))
@@ -288,6 +296,9 @@ func CompareIndexes(conn1 *sql.DB, conn2 *sql.DB) {
 	}
 	sort.Sort(rows2)
 
+	// Primary key and unique constraints of the tables that db2 does not have are part of their CREATE TABLE
+	loadDb2Tables(conn2)
+
 	// We have to explicitly type this as Schema here for some unknown reason
 	var schema1 Schema = &IndexSchema{rows: rows1, rowNum: -1}
 	var schema2 Schema = &IndexSchema{rows: rows2, rowNum: -1}
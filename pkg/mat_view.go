@@ -7,13 +7,65 @@
 package pkg
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
 	"sort"
+	"strings"
+	"text/template"
 
 	"github.com/jiapeish/pgdiff/pgutil"
 )
 
+var (
+	matViewSqlTemplate = initMatViewSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// index_defs holds one CREATE INDEX statement per line.  grants holds one
+// "<privilege> TO <grantee>" per line, leaving out the owner's own privileges.
+// dependents is described at viewDependentsColumnSql.
+func initMatViewSqlTemplate() *template.Template {
+	sql := `
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS compare_name
+    , n.nspname AS schema_name
+    , c.relname AS matview_name
+    , pg_catalog.pg_get_viewdef(c.oid, true) AS definition
+    , c.relispopulated AS populated
+    , ts.spcname AS tablespace
+    , array_to_string(c.reloptions, ', ') AS storage_options
+    , pg_catalog.pg_get_userbyid(c.relowner) AS owner
+    , pg_catalog.obj_description(c.oid, 'pg_class') AS description
+    , (SELECT string_agg(acl.privilege_type || ' TO ' || CASE WHEN acl.grantee = 0 THEN 'PUBLIC' ELSE quote_ident(pg_catalog.pg_get_userbyid(acl.grantee)) END
+                         || CASE WHEN acl.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END, E'\n' ORDER BY acl.grantee, acl.privilege_type)
+       FROM aclexplode(c.relacl) AS acl
+       WHERE acl.grantee <> c.relowner) AS grants
+    , (SELECT string_agg(pg_catalog.pg_get_indexdef(i.indexrelid), E'\n' ORDER BY ic.relname)
+       FROM pg_catalog.pg_index i
+       INNER JOIN pg_catalog.pg_class ic ON (ic.oid = i.indexrelid)
+       WHERE i.indrelid = c.oid) AS index_defs
+    , EXISTS (SELECT 1 FROM pg_catalog.pg_index i
+              WHERE i.indrelid = c.oid AND i.indisunique AND i.indisvalid
+              AND i.indpred IS NULL AND i.indexprs IS NULL) AS has_unique_index
+` + viewDependentsColumnSql + `FROM pg_catalog.pg_class c
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+LEFT OUTER JOIN pg_catalog.pg_tablespace ts ON (ts.oid = c.reltablespace)
+WHERE c.relkind = 'm'
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name;
+`
+	t := template.New("MatViewSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
 // ==================================
 // MatViewRows definition
 // ==================================
@@ -26,7 +78,7 @@ func (slice MatViewRows) Len() int {
 }
 
 func (slice MatViewRows) Less(i, j int) bool {
-	return slice[i]["matviewname"] < slice[j]["matviewname"]
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
 }
 
 func (slice MatViewRows) Swap(i, j int) {
@@ -38,9 +90,10 @@ func (slice MatViewRows) Swap(i, j int) {
 //
 // MatViewSchema implements the Schema interface defined in pgdiff.go
 type MatViewSchema struct {
-	rows   MatViewRows
-	rowNum int
-	done   bool
+	rows     MatViewRows
+	rowNum   int
+	done     bool
+	db1Views map[string]map[string]string // db1's views keyed by compare_name, for recreating dependent views
 }
 
 // get returns the value from the current row for the given key
@@ -68,54 +121,206 @@ func (c *MatViewSchema) Compare(obj interface{}) int {
 		return +999
 	}
 
-	val := pgutil.CompareStrings(c.get("matviewname"), c2.get("matviewname"))
-	//fmt.Printf("-- Compared %v: %s with %s \n", val, c.get("matviewname"), c2.get("matviewname"))
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	//fmt.Printf("-- Compared %v: %s with %s \n", val, c.get("compare_name"), c2.get("compare_name"))
 	return val
 }
 
+// indexDefs returns the matview's CREATE INDEX statements (changed to create them in the given schema) keyed by index name
+func (c *MatViewSchema) indexDefs(schema string) map[string]string {
+	defs := make(map[string]string)
+	if c.get("index_defs") == "null" {
+		return defs
+	}
+	for _, def := range strings.Split(c.get("index_defs"), "\n") {
+		def = strings.Replace(def,
+			fmt.Sprintf(" ON %s.%s ", c.get("schema_name"), c.get("matview_name")),
+			fmt.Sprintf(" ON %s.%s ", schema, c.get("matview_name")), 1)
+		// CREATE [UNIQUE] INDEX <name> ON ...
+		fields := strings.Fields(def)
+		for i := 0; i < len(fields)-1; i++ {
+			if fields[i] == "INDEX" {
+				defs[fields[i+1]] = def
+				break
+			}
+		}
+	}
+	return defs
+}
+
+// sortedKeys returns the keys of the map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printOwnerAndGrants prints SQL that gives a new (or recreated) view or matview the
+// owner and grants in the given row.  name includes the schema.
+func printOwnerAndGrants(objectType string, name string, row map[string]string) {
+	fmt.Printf("ALTER %s %s OWNER TO %s;\n", objectType, name, row["owner"])
+	if row["grants"] == "null" {
+		return
+	}
+	for _, grant := range strings.Split(row["grants"], "\n") {
+		parts := strings.SplitN(grant, " TO ", 2)
+		if len(parts) == 2 {
+			fmt.Printf("GRANT %s ON %s TO %s;\n", parts[0], name, parts[1])
+		}
+	}
+}
+
+// create prints SQL to create the matview (and its indexes, owner, grants and comment) in the given schema
+func (c *MatViewSchema) create(schema string) {
+	createSql := fmt.Sprintf("CREATE MATERIALIZED VIEW %s.%s", schema, c.get("matview_name"))
+	if c.get("storage_options") != "null" {
+		createSql += fmt.Sprintf(" WITH (%s)", c.get("storage_options"))
+	}
+	if c.get("tablespace") != "null" {
+		createSql += fmt.Sprintf(" TABLESPACE %s", c.get("tablespace"))
+	}
+	createSql += fmt.Sprintf(" AS\n%s", strings.TrimSuffix(c.get("definition"), ";"))
+	if c.get("populated") == "true" {
+		createSql += "\nWITH DATA;"
+	} else {
+		createSql += "\nWITH NO DATA;"
+	}
+	fmt.Println(createSql)
+
+	indexDefs := c.indexDefs(schema)
+	for _, name := range sortedKeys(indexDefs) {
+		fmt.Printf("%s;\n", indexDefs[name])
+	}
+	printOwnerAndGrants("MATERIALIZED VIEW", schema+"."+c.get("matview_name"), c.rows[c.rowNum])
+	if c.get("description") != "null" {
+		fmt.Printf("COMMENT ON MATERIALIZED VIEW %s.%s IS %s;\n", schema, c.get("matview_name"), quoteLiteral(c.get("description")))
+	}
+	fmt.Println()
+}
+
+// refresh prints SQL to refresh the data of the (already populated) matview with the given name.
+// A concurrent refresh does not block readers, but it needs a unique index.  Whether there is
+// one comes from db1's matview, because Change has just made db2's indexes match it.
+func (c *MatViewSchema) refresh(name string) {
+	if c.get("has_unique_index") == "true" {
+		fmt.Printf("REFRESH MATERIALIZED VIEW CONCURRENTLY %s;\n", name)
+	} else {
+		fmt.Printf("REFRESH MATERIALIZED VIEW %s; -- no unique index, so it cannot be refreshed concurrently\n", name)
+	}
+}
+
 // Add returns SQL to create the matview
 func (c MatViewSchema) Add() {
-	fmt.Printf("CREATE MATERIALIZED VIEW %s AS %s \n\n%s \n\n", c.get("matviewname"), c.get("definition"), c.get("indexdef"))
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+	c.create(schema)
 }
 
 // Drop returns SQL to drop the matview
 func (c MatViewSchema) Drop() {
-	fmt.Printf("DROP MATERIALIZED VIEW %s;\n\n", c.get("matviewname"))
+	fmt.Printf("DROP MATERIALIZED VIEW %s.%s;\n\n", c.get("schema_name"), c.get("matview_name"))
 }
 
-// Change handles the case where the names match, but the definition does not
+// Change handles the case where the names match, but the definition, storage or indexes do not
 func (c MatViewSchema) Change(obj interface{}) {
 	c2, ok := obj.(*MatViewSchema)
 	if !ok {
 		fmt.Println("Error!!!, Change needs a MatViewSchema instance", c2)
 	}
+
+	schema := c2.get("schema_name")
+	name := fmt.Sprintf("%s.%s", schema, c2.get("matview_name"))
+
 	if c.get("definition") != c2.get("definition") {
-		fmt.Printf("DROP MATERIALIZED VIEW %s;\n\n", c.get("matviewname"))
-		fmt.Printf("CREATE MATERIALIZED VIEW %s AS %s \n\n%s \n\n", c.get("matviewname"), c.get("definition"), c.get("indexdef"))
+		// Dropping the matview drops its indexes, grants and comment too, so they are recreated,
+		// and so are the views that depend on it
+		fmt.Printf("-- The definition of %s is different so we'll recreate it (with its indexes, owner, grants and comment, and the views that depend on it):\n", name)
+		dependents := parseViewDependents(name, c2.get("dependents"))
+		dropViewDependents(dependents)
+		fmt.Printf("DROP MATERIALIZED VIEW %s;\n", name)
+		c.create(schema)
+		recreateViewDependents(dependents, c.db1Views)
+		return
+	}
+
+	if c.get("tablespace") != c2.get("tablespace") {
+		tablespace := c.get("tablespace")
+		if tablespace == "null" {
+			tablespace = "pg_default"
+		}
+		fmt.Printf("ALTER MATERIALIZED VIEW %s SET TABLESPACE %s;\n", name, tablespace)
+	}
+
+	if c.get("storage_options") != c2.get("storage_options") {
+		options1 := parseStorageOptions(c.get("storage_options"))
+		options2 := parseStorageOptions(c2.get("storage_options"))
+		resets := []string{}
+		for _, option := range sortedKeys(options2) {
+			if _, ok := options1[option]; !ok {
+				resets = append(resets, option)
+			}
+		}
+		if len(resets) > 0 {
+			fmt.Printf("ALTER MATERIALIZED VIEW %s RESET (%s);\n", name, strings.Join(resets, ", "))
+		}
+		if c.get("storage_options") != "null" {
+			fmt.Printf("ALTER MATERIALIZED VIEW %s SET (%s);\n", name, c.get("storage_options"))
+		}
+	}
+
+	indexDefs1 := c.indexDefs(schema)
+	indexDefs2 := c2.indexDefs(schema)
+	for _, index := range sortedKeys(indexDefs2) {
+		if def, ok := indexDefs1[index]; !ok || def != indexDefs2[index] {
+			fmt.Printf("DROP INDEX %s.%s;\n", schema, index)
+		}
+	}
+	for _, index := range sortedKeys(indexDefs1) {
+		if def, ok := indexDefs2[index]; !ok || def != indexDefs1[index] {
+			fmt.Printf("%s;\n", indexDefs1[index])
+		}
 	}
+
+	if c.get("populated") == "true" && c2.get("populated") != "true" {
+		fmt.Printf("REFRESH MATERIALIZED VIEW %s;\n", name)
+	} else if c.get("populated") != "true" && c2.get("populated") == "true" {
+		fmt.Printf("REFRESH MATERIALIZED VIEW %s WITH NO DATA;\n", name)
+	} else if RefreshMatViews && c.get("populated") == "true" {
+		c.refresh(name)
+	}
+}
+
+// parseStorageOptions returns a map of the storage parameters in a comma separated list of name=value
+func parseStorageOptions(options string) map[string]string {
+	m := make(map[string]string)
+	if options == "null" {
+		return m
+	}
+	for _, option := range strings.Split(options, ", ") {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) == 2 {
+			m[parts[0]] = parts[1]
+		}
+	}
+	return m
 }
 
 // compareMatViews outputs SQL to make the matviews match between DBs
 func CompareMatViews(conn1 *sql.DB, conn2 *sql.DB) {
-	sql := `
-	WITH matviews as ( SELECT schemaname || '.' || matviewname AS matviewname,
-	definition
-	FROM pg_catalog.pg_matviews 
-	WHERE schemaname NOT LIKE 'pg_%' 
-	)
-	SELECT
-	matviewname,
-	definition,
-	COALESCE(string_agg(indexdef, ';' || E'\n\n') || ';', '')  as indexdef
-	FROM matviews
-	LEFT JOIN  pg_catalog.pg_indexes on matviewname = schemaname || '.' || tablename
-	group by matviewname, definition
-	ORDER BY
-	matviewname;
-	`
-
-	rowChan1, _ := pgutil.QueryStrings(conn1, sql)
-	rowChan2, _ := pgutil.QueryStrings(conn2, sql)
+
+	buf1 := new(bytes.Buffer)
+	matViewSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	matViewSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
 
 	rows1 := make(MatViewRows, 0)
 	for row := range rowChan1 {
@@ -129,8 +334,14 @@ func CompareMatViews(conn1 *sql.DB, conn2 *sql.DB) {
 	}
 	sort.Sort(rows2)
 
+	// Views that depend on a recreated matview are recreated from db1's definition
+	db1Views := make(map[string]map[string]string)
+	for compareName, rows := range groupRowsByCompareName(conn1, viewSqlTemplate, DbInfo1) {
+		db1Views[compareName] = rows[0]
+	}
+
 	// We have to explicitly type this as Schema here
-	var schema1 Schema = &MatViewSchema{rows: rows1, rowNum: -1}
+	var schema1 Schema = &MatViewSchema{rows: rows1, rowNum: -1, db1Views: db1Views}
 	var schema2 Schema = &MatViewSchema{rows: rows2, rowNum: -1}
 
 	// Compare the matviews
@@ -21,20 +21,94 @@ var (
 )
 
 // Initializes the Sql template
+//
+// Sequences owned by a column (including identity sequences) are left out because they
+// always follow the owner of their table.
 func initOwnerSqlTemplate() *template.Template {
 	sql := `
 SELECT n.nspname AS schema_name
-    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname || '.' || c.relname AS compare_name
-    , c.relname AS relationship_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}'SCHEMA' AS compare_name
+    , n.nspname::text AS object_name
+    , a.rolname AS owner
+    , 'SCHEMA' AS type
+FROM pg_namespace AS n
+INNER JOIN pg_roles AS a ON (a.oid = n.nspowner)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_namespace'::regclass AND d.objid = n.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%' 
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+UNION ALL
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}CASE WHEN c.relkind IN ('r', 'p') THEN 'TABLE' ELSE c.relkind::text END || '.' || c.relname AS compare_name
+    , c.relname::text AS object_name
     , a.rolname AS owner
-    , CASE WHEN c.relkind = 'r' THEN 'TABLE' 
-        WHEN c.relkind = 'S' THEN 'SEQUENCE' 
-        WHEN c.relkind = 'v' THEN 'VIEW' 
+    , CASE WHEN c.relkind IN ('r', 'p') THEN 'TABLE'
+        WHEN c.relkind = 'S' THEN 'SEQUENCE'
+        WHEN c.relkind = 'v' THEN 'VIEW'
+        WHEN c.relkind = 'm' THEN 'MATERIALIZED VIEW'
+        WHEN c.relkind = 'f' THEN 'FOREIGN TABLE'
         ELSE c.relkind::varchar END AS type
 FROM pg_class AS c
 INNER JOIN pg_roles AS a ON (a.oid = c.relowner)
 INNER JOIN pg_namespace AS n ON (n.oid = c.relnamespace)
-WHERE c.relkind IN ('r', 'S', 'v')
+WHERE c.relkind IN ('r', 'p', 'S', 'v', 'm', 'f')
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid
+    AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i') AND c.relkind = 'S')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%' 
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+UNION ALL
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}'FUNCTION.' || p.proname || '(' || pg_catalog.oidvectortypes(p.proargtypes) || ')' AS compare_name
+    , p.proname || '(' || CASE WHEN p.prokind = 'a' AND p.pronargs = 0 THEN '*'
+        ELSE pg_catalog.pg_get_function_identity_arguments(p.oid) END || ')' AS object_name
+    , a.rolname AS owner
+    , CASE p.prokind WHEN 'p' THEN 'PROCEDURE' WHEN 'a' THEN 'AGGREGATE' ELSE 'FUNCTION' END AS type
+FROM pg_proc AS p
+INNER JOIN pg_roles AS a ON (a.oid = p.proowner)
+INNER JOIN pg_namespace AS n ON (n.oid = p.pronamespace)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%' 
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+UNION ALL
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}'TYPE.' || t.typname AS compare_name
+    , t.typname::text AS object_name
+    , a.rolname AS owner
+    , CASE WHEN t.typtype = 'd' THEN 'DOMAIN' ELSE 'TYPE' END AS type
+FROM pg_type AS t
+INNER JOIN pg_roles AS a ON (a.oid = t.typowner)
+INNER JOIN pg_namespace AS n ON (n.oid = t.typnamespace)
+WHERE t.typtype IN ('c', 'd', 'e', 'r')
+AND (t.typrelid = 0 OR (SELECT c.relkind FROM pg_catalog.pg_class c WHERE c.oid = t.typrelid) = 'c')
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_type'::regclass AND d.objid = t.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%' 
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+UNION ALL
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}'STATISTICS.' || s.stxname AS compare_name
+    , s.stxname::text AS object_name
+    , a.rolname AS owner
+    , 'STATISTICS' AS type
+FROM pg_statistic_ext AS s
+INNER JOIN pg_roles AS a ON (a.oid = s.stxowner)
+INNER JOIN pg_namespace AS n ON (n.oid = s.stxnamespace)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_statistic_ext'::regclass AND d.objid = s.oid AND d.deptype = 'e')
 {{if eq $.DbSchema "*" }}
 AND n.nspname NOT LIKE 'pg_%' 
 AND n.nspname <> 'information_schema'
@@ -48,6 +122,55 @@ AND n.nspname = '{{$.DbSchema}}'
 	return t
 }
 
+// globalOwnerSql selects the owners of objects that belong to the database rather than to a schema
+var globalOwnerSql = `
+SELECT NULL AS schema_name
+    , 'EVENT TRIGGER.' || e.evtname AS compare_name
+    , e.evtname::text AS object_name
+    , a.rolname AS owner
+    , 'EVENT TRIGGER' AS type
+FROM pg_event_trigger AS e
+INNER JOIN pg_roles AS a ON (a.oid = e.evtowner)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_event_trigger'::regclass AND d.objid = e.oid AND d.deptype = 'e')
+UNION ALL
+SELECT NULL AS schema_name
+    , 'FOREIGN DATA WRAPPER.' || w.fdwname AS compare_name
+    , w.fdwname::text AS object_name
+    , a.rolname AS owner
+    , 'FOREIGN DATA WRAPPER' AS type
+FROM pg_foreign_data_wrapper AS w
+INNER JOIN pg_roles AS a ON (a.oid = w.fdwowner)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_foreign_data_wrapper'::regclass AND d.objid = w.oid AND d.deptype = 'e')
+UNION ALL
+SELECT NULL AS schema_name
+    , 'SERVER.' || s.srvname AS compare_name
+    , s.srvname::text AS object_name
+    , a.rolname AS owner
+    , 'SERVER' AS type
+FROM pg_foreign_server AS s
+INNER JOIN pg_roles AS a ON (a.oid = s.srvowner)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_foreign_server'::regclass AND d.objid = s.oid AND d.deptype = 'e')
+;`
+
+// ownerSchemaTypes maps the kinds of owned objects to the pgdiff schema type that creates them
+var ownerSchemaTypes = map[string]string{
+	"SCHEMA":               "SCHEMA",
+	"TABLE":                "TABLE",
+	"SEQUENCE":             "SEQUENCE",
+	"VIEW":                 "VIEW",
+	"MATERIALIZED VIEW":    "MATVIEW",
+	"FOREIGN TABLE":        "FOREIGN_TABLE",
+	"FUNCTION":             "FUNCTION",
+	"PROCEDURE":            "FUNCTION",
+	"AGGREGATE":            "FUNCTION",
+	"TYPE":                 "TYPE",
+	"DOMAIN":               "TYPE",
+	"STATISTICS":           "STATISTICS",
+	"EVENT TRIGGER":        "EVENT_TRIGGER",
+	"FOREIGN DATA WRAPPER": "FOREIGN_DATA_WRAPPER",
+	"SERVER":               "FOREIGN_SERVER",
+}
+
 // ==================================
 // OwnerRows definition
 // ==================================
@@ -117,17 +240,29 @@ func (c *OwnerSchema) Compare(obj interface{}) int {
 	return val
 }
 
-// Add generates SQL to add the table/view owner
+// objectName returns the kind and name of the current object as used in ALTER ... OWNER TO,
+// qualified with the given schema when the object lives in one
+func (c *OwnerSchema) objectName(schema string) string {
+	switch c.get("type") {
+	case "SCHEMA":
+		return "SCHEMA " + schema
+	case "EVENT TRIGGER", "FOREIGN DATA WRAPPER", "SERVER":
+		return c.get("type") + " " + c.get("object_name")
+	}
+	return fmt.Sprintf("%s %s.%s", c.get("type"), schema, c.get("object_name"))
+}
+
+// Add generates SQL to add the owner
 func (c OwnerSchema) Add() {
-	fmt.Printf("-- Notice!, db2 has no %s named %s.  First, run pgdiff with the %s option.\n", c.get("type"), c.get("relationship_name"), c.get("type"))
+	fmt.Printf("-- Notice!, db2 has no %s named %s.  First, run pgdiff with the %s option.\n", c.get("type"), c.get("object_name"), ownerSchemaTypes[c.get("type")])
 }
 
 // Drop generates SQL to drop the owner
 func (c OwnerSchema) Drop() {
-	fmt.Printf("-- Notice!, db2 has a %s that db1 does not: %s.   First, run pgdiff with the %s option.\n", c.get("type"), c.get("relationship_name"), c.get("type"))
+	fmt.Printf("-- Notice!, db2 has a %s that db1 does not: %s.   First, run pgdiff with the %s option.\n", c.get("type"), c.get("object_name"), ownerSchemaTypes[c.get("type")])
 }
 
-// Change handles the case where the relationship name matches, but the owner does not
+// Change handles the case where the object name matches, but the owner does not
 func (c OwnerSchema) Change(obj interface{}) {
 	c2, ok := obj.(*OwnerSchema)
 	if !ok {
@@ -135,11 +270,12 @@ func (c OwnerSchema) Change(obj interface{}) {
 	}
 
 	if c.get("owner") != c2.get("owner") {
-		fmt.Printf("ALTER %s %s.%s OWNER TO %s; \n", c.get("type"), c2.get("schema_name"), c.get("relationship_name"), c.get("owner"))
+		fmt.Printf("ALTER %s OWNER TO %s; \n", c2.objectName(c2.get("schema_name")), c.get("owner"))
 	}
 }
 
-// compareOwners compares the ownership of tables, sequences, and views between two databases or schemas
+// CompareOwners compares the ownership of schemas, relationships, functions, types, statistics and (when the
+// same schemas are compared) event triggers, foreign-data wrappers and foreign servers between two databases or schemas
 func CompareOwners(conn1 *sql.DB, conn2 *sql.DB) {
 
 	buf1 := new(bytes.Buffer)
@@ -155,12 +291,25 @@ func CompareOwners(conn1 *sql.DB, conn2 *sql.DB) {
 	for row := range rowChan1 {
 		rows1 = append(rows1, row)
 	}
-	sort.Sort(rows1)
 
 	rows2 := make(OwnerRows, 0)
 	for row := range rowChan2 {
 		rows2 = append(rows2, row)
 	}
+
+	// Database-wide objects are only compared when the same schemas are being compared
+	if DbInfo1.DbSchema == DbInfo2.DbSchema {
+		globalChan1, _ := pgutil.QueryStrings(conn1, globalOwnerSql)
+		for row := range globalChan1 {
+			rows1 = append(rows1, row)
+		}
+
+		globalChan2, _ := pgutil.QueryStrings(conn2, globalOwnerSql)
+		for row := range globalChan2 {
+			rows2 = append(rows2, row)
+		}
+	}
+	sort.Sort(rows1)
 	sort.Sort(rows2)
 
 	// We have to explicitly type this as Schema here for some unknown reason
@@ -0,0 +1,295 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	partitionSqlTemplate = initPartitionSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// compare_name is the path from the top partitioned table down to each partition
+// (e.g. public.orders.orders_2020.orders_2020_q1) so that a partition always sorts
+// after the table it is a partition of.
+func initPartitionSqlTemplate() *template.Template {
+	sql := `
+WITH RECURSIVE parts AS (
+    SELECT c.oid, c.relname::text AS path, c.oid AS top_oid
+    FROM pg_catalog.pg_class c
+    WHERE c.relkind = 'p'
+    AND NOT c.relispartition
+  UNION ALL
+    SELECT child.oid, parts.path || '.' || child.relname, parts.top_oid
+    FROM parts
+    INNER JOIN pg_catalog.pg_inherits i ON (i.inhparent = parts.oid)
+    INNER JOIN pg_catalog.pg_class child ON (child.oid = i.inhrelid)
+    WHERE child.relkind <> 'f' -- foreign partitions are compared by FOREIGN_TABLE
+)
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}parts.path AS compare_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS table_compare_name
+    , {{if eq $.DbSchema "*" }}tn.nspname || '.' || {{end}}tc.relname AS top_compare_name
+    , n.nspname AS schema_name
+    , c.relname AS table_name
+    , pn.nspname AS parent_schema
+    , pc.relname AS parent_name
+    , pg_catalog.pg_get_expr(c.relpartbound, c.oid) AS partition_bound
+    , CASE WHEN c.relkind = 'p' THEN pg_catalog.pg_get_partkeydef(c.oid) END AS partition_key
+FROM parts
+INNER JOIN pg_catalog.pg_class c ON (c.oid = parts.oid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+INNER JOIN pg_catalog.pg_class tc ON (tc.oid = parts.top_oid)
+INNER JOIN pg_catalog.pg_namespace tn ON (tn.oid = tc.relnamespace)
+LEFT OUTER JOIN pg_catalog.pg_inherits i ON (i.inhrelid = c.oid)
+LEFT OUTER JOIN pg_catalog.pg_class pc ON (pc.oid = i.inhparent)
+LEFT OUTER JOIN pg_catalog.pg_namespace pn ON (pn.oid = pc.relnamespace)
+WHERE true
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name;
+`
+	t := template.New("PartitionSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// PartitionRows definition
+// ==================================
+
+// PartitionRows is a sortable slice of string maps
+type PartitionRows []map[string]string
+
+func (slice PartitionRows) Len() int {
+	return len(slice)
+}
+
+func (slice PartitionRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice PartitionRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// PartitionSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.  A row is either a top-level
+// partitioned table (parent_name is null) or a partition, which may itself be partitioned.
+//
+// PartitionSchema implements the Schema interface defined in pgdiff.go
+type PartitionSchema struct {
+	rows        PartitionRows
+	rowNum      int
+	done        bool
+	otherTables map[string][]map[string]string // the tables of the other database, keyed by compare_name
+	otherParts  map[string]map[string]string   // the partition rows of the other database, keyed by table_compare_name
+	constraints map[string][]map[string]string // the (local) constraint definitions of db1's tables, keyed by compare_name
+}
+
+// get returns the value from the current row for the given key
+func (c *PartitionSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// isTopLevel tells you whether the current row is a partitioned table that is not itself a partition
+func (c *PartitionSchema) isTopLevel() bool {
+	return c.get("parent_name") == "null"
+}
+
+// inOtherDb tells you whether the other database has a table with the same name as the current row
+func (c *PartitionSchema) inOtherDb() bool {
+	_, ok := c.otherTables[c.get("table_compare_name")]
+	return ok
+}
+
+// isPartitionInOtherDb tells you whether the table of the current row is a partition (of any
+// parent) in the other database
+func (c *PartitionSchema) isPartitionInOtherDb() bool {
+	other, ok := c.otherParts[c.get("table_compare_name")]
+	return ok && other["parent_name"] != "null"
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *PartitionSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *PartitionSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*PartitionSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a PartitionSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// Add returns SQL to create the partition, or to attach it when db2 already has the table
+func (c *PartitionSchema) Add() {
+	schema := DbInfo2.DbSchema
+	parentSchema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+		parentSchema = c.get("parent_schema")
+	}
+
+	if c.isTopLevel() {
+		if c.inOtherDb() {
+			fmt.Printf("-- WARNING: %s.%s is partitioned in db1 but not in db2.  It must be recreated (and its data copied) to partition it.\n", schema, c.get("table_name"))
+		}
+		// Otherwise the TABLE schema type creates it
+		return
+	}
+
+	if c.inOtherDb() {
+		if c.get("partition_key") != "null" {
+			fmt.Printf("-- WARNING: %s.%s must be partitioned by %s before it can be attached.\n", schema, c.get("table_name"), c.get("partition_key"))
+		}
+		// A partition that moves to another parent is detached first (so Drop skips it)
+		if c.isPartitionInOtherDb() {
+			other := c.otherParts[c.get("table_compare_name")]
+			fmt.Printf("ALTER TABLE %s.%s DETACH PARTITION %s.%s;\n", other["parent_schema"], other["parent_name"], other["schema_name"], other["table_name"])
+		}
+		fmt.Printf("ALTER TABLE %s.%s ATTACH PARTITION %s.%s %s;\n", parentSchema, c.get("parent_name"), schema, c.get("table_name"), c.get("partition_bound"))
+		return
+	}
+
+	// The partition's own constraints (not the ones it gets from its parent) are part of the
+	// statement, as CHECK_CONSTRAINT and INDEX leave the tables that db2 does not have alone
+	var lines []string
+	for _, con := range c.constraints[c.get("table_compare_name")] {
+		lines = append(lines, fmt.Sprintf("    CONSTRAINT %s %s", con["constraint_name"], con["constraint_def"]))
+	}
+	fmt.Printf("CREATE TABLE %s.%s PARTITION OF %s.%s", schema, c.get("table_name"), parentSchema, c.get("parent_name"))
+	if len(lines) > 0 {
+		fmt.Printf(" (\n%s\n)", strings.Join(lines, ",\n"))
+	}
+	fmt.Printf(" %s", c.get("partition_bound"))
+	if c.get("partition_key") != "null" {
+		fmt.Printf(" PARTITION BY %s", c.get("partition_key"))
+	}
+	fmt.Println(";")
+}
+
+// Drop returns SQL to detach the partition, and to drop it when db1 does not have the table at all
+func (c *PartitionSchema) Drop() {
+	if c.isTopLevel() {
+		if c.inOtherDb() {
+			fmt.Printf("-- WARNING: %s.%s is partitioned in db2 but not in db1.  It must be recreated (and its data copied) to match.\n", c.get("schema_name"), c.get("table_name"))
+		}
+		// Otherwise the TABLE schema type drops it
+		return
+	}
+
+	// Dropping the top-level table (in TABLE) dropped its partitions too
+	if _, ok := c.otherTables[c.get("top_compare_name")]; !ok {
+		return
+	}
+
+	// A partition that moves to another parent was detached by Add
+	if c.isPartitionInOtherDb() {
+		return
+	}
+
+	fmt.Printf("ALTER TABLE %s.%s DETACH PARTITION %s.%s;\n", c.get("parent_schema"), c.get("parent_name"), c.get("schema_name"), c.get("table_name"))
+	if !c.inOtherDb() {
+		fmt.Printf("DROP TABLE %s.%s;\n", c.get("schema_name"), c.get("table_name"))
+	}
+}
+
+// Change handles the case where the partition paths match, but the bounds or partition keys do not
+func (c *PartitionSchema) Change(obj interface{}) {
+	c2, ok := obj.(*PartitionSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a PartitionSchema instance", c2)
+	}
+
+	// The partition key of a table cannot be altered
+	if c.get("partition_key") != c2.get("partition_key") {
+		fmt.Printf("-- WARNING: %s.%s is partitioned differently (%s to %s).  It must be recreated (and its data copied) to match.\n",
+			c2.get("schema_name"), c.get("table_name"), c2.get("partition_key"), c.get("partition_key"))
+	}
+
+	if !c.isTopLevel() && c.get("partition_bound") != c2.get("partition_bound") {
+		fmt.Printf("-- Changing partition bounds from: %s\n", c2.get("partition_bound"))
+		fmt.Printf("ALTER TABLE %s.%s DETACH PARTITION %s.%s;\n", c2.get("parent_schema"), c2.get("parent_name"), c2.get("schema_name"), c2.get("table_name"))
+		fmt.Printf("ALTER TABLE %s.%s ATTACH PARTITION %s.%s %s;\n", c2.get("parent_schema"), c2.get("parent_name"), c2.get("schema_name"), c2.get("table_name"), c.get("partition_bound"))
+	}
+}
+
+// ComparePartitions outputs SQL to make the partitions of partitioned tables match between DBs or schemas
+func ComparePartitions(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	partitionSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	partitionSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(PartitionRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(PartitionRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// Each side needs to know which tables the other side has, so that a table can
+	// be attached or detached instead of created or dropped
+	tables1 := groupRowsByCompareName(conn1, tableSqlTemplate, DbInfo1)
+	tables2 := groupRowsByCompareName(conn2, tableSqlTemplate, DbInfo2)
+
+	parts1 := make(map[string]map[string]string)
+	for _, row := range rows1 {
+		parts1[row["table_compare_name"]] = row
+	}
+	parts2 := make(map[string]map[string]string)
+	for _, row := range rows2 {
+		parts2[row["table_compare_name"]] = row
+	}
+
+	// Only db1 partitions are ever created, so only db1 needs the constraint definitions
+	constraints := groupRowsByCompareName(conn1, tableConstraintSqlTemplate, DbInfo1)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &PartitionSchema{rows: rows1, rowNum: -1, otherTables: tables2, otherParts: parts2, constraints: constraints}
+	var schema2 Schema = &PartitionSchema{rows: rows2, rowNum: -1, otherTables: tables1, otherParts: parts1}
+
+	// Compare the partitions
+	DoDiff(schema1, schema2)
+}
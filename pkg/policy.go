@@ -0,0 +1,286 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	policySqlTemplate = initPolicySqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// The first half of the union returns one row per table that has row level security
+// enabled or forced.  Its compare_name sorts just before the policies on that table.
+func initPolicySqlTemplate() *template.Template {
+	sql := `
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS compare_name
+    , n.nspname AS schema_name
+    , c.relname AS table_name
+    , NULL AS policy_name
+    , c.relrowsecurity AS row_security
+    , c.relforcerowsecurity AS force_row_security
+    , NULL AS command
+    , NULL AS permissive
+    , NULL AS roles
+    , NULL AS using_expr
+    , NULL AS check_expr
+FROM pg_catalog.pg_class c
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+WHERE c.relkind IN ('r', 'p')
+AND (c.relrowsecurity OR c.relforcerowsecurity)
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+UNION ALL
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname || '.' || p.polname AS compare_name
+    , n.nspname AS schema_name
+    , c.relname AS table_name
+    , p.polname AS policy_name
+    , NULL AS row_security
+    , NULL AS force_row_security
+    , CASE p.polcmd
+      WHEN 'r' THEN 'SELECT'
+      WHEN 'a' THEN 'INSERT'
+      WHEN 'w' THEN 'UPDATE'
+      WHEN 'd' THEN 'DELETE'
+      ELSE 'ALL' END AS command
+    , CASE WHEN p.polpermissive THEN 'PERMISSIVE' ELSE 'RESTRICTIVE' END AS permissive
+    , CASE WHEN p.polroles = '{0}' THEN 'PUBLIC'
+      ELSE array_to_string(ARRAY(SELECT quote_ident(r.rolname)
+                                 FROM pg_catalog.pg_roles r
+                                 WHERE r.oid = ANY (p.polroles)
+                                 ORDER BY r.rolname), ', ') END AS roles
+    , pg_catalog.pg_get_expr(p.polqual, p.polrelid) AS using_expr
+    , pg_catalog.pg_get_expr(p.polwithcheck, p.polrelid) AS check_expr
+FROM pg_catalog.pg_policy p
+INNER JOIN pg_catalog.pg_class c ON (c.oid = p.polrelid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+WHERE true
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+`
+	t := template.New("PolicySqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// PolicyRows definition
+// ==================================
+
+// PolicyRows is a sortable slice of string maps
+type PolicyRows []map[string]string
+
+func (slice PolicyRows) Len() int {
+	return len(slice)
+}
+
+func (slice PolicyRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice PolicyRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ==================================
+// PolicySchema definition
+// (implements Schema -- defined in pgdiff.go)
+// ==================================
+
+// PolicySchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.  A row is either a
+// policy or the row level security flags of a table (when policy_name is null).
+type PolicySchema struct {
+	rows   PolicyRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *PolicySchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// isTable tells you whether the current row holds the row level security flags of a table
+func (c *PolicySchema) isTable() bool {
+	return c.get("policy_name") == "null"
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *PolicySchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *PolicySchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*PolicySchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a PolicySchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// createPolicy prints SQL to create the policy in the given schema
+func (c *PolicySchema) createPolicy(schema string) {
+	policySql := fmt.Sprintf("CREATE POLICY %s ON %s.%s AS %s FOR %s TO %s", c.get("policy_name"), schema, c.get("table_name"), c.get("permissive"), c.get("command"), c.get("roles"))
+	if c.get("using_expr") != "null" {
+		policySql += fmt.Sprintf(" USING (%s)", c.get("using_expr"))
+	}
+	if c.get("check_expr") != "null" {
+		policySql += fmt.Sprintf(" WITH CHECK (%s)", c.get("check_expr"))
+	}
+	fmt.Printf("%s;\n", policySql)
+}
+
+// Add returns SQL to create the policy or to enable row level security on the table
+func (c *PolicySchema) Add() {
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+
+	if c.isTable() {
+		if c.get("row_security") == "true" {
+			fmt.Printf("ALTER TABLE %s.%s ENABLE ROW LEVEL SECURITY;\n", schema, c.get("table_name"))
+		}
+		if c.get("force_row_security") == "true" {
+			fmt.Printf("ALTER TABLE %s.%s FORCE ROW LEVEL SECURITY;\n", schema, c.get("table_name"))
+		}
+		return
+	}
+
+	c.createPolicy(schema)
+}
+
+// Drop returns SQL to drop the policy or to disable row level security on the table
+func (c *PolicySchema) Drop() {
+	if c.isTable() {
+		fmt.Printf("-- WARNING: db1 does not use row level security on %s.%s.  Make sure this is intended.\n", c.get("schema_name"), c.get("table_name"))
+		if c.get("row_security") == "true" {
+			fmt.Printf("ALTER TABLE %s.%s DISABLE ROW LEVEL SECURITY;\n", c.get("schema_name"), c.get("table_name"))
+		}
+		if c.get("force_row_security") == "true" {
+			fmt.Printf("ALTER TABLE %s.%s NO FORCE ROW LEVEL SECURITY;\n", c.get("schema_name"), c.get("table_name"))
+		}
+		return
+	}
+
+	fmt.Printf("DROP POLICY %s ON %s.%s;\n", c.get("policy_name"), c.get("schema_name"), c.get("table_name"))
+}
+
+// Change handles the case where the policy (or table) names match, but the details do not
+func (c *PolicySchema) Change(obj interface{}) {
+	c2, ok := obj.(*PolicySchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a PolicySchema instance", c2)
+	}
+
+	if c.isTable() {
+		if c.get("row_security") != c2.get("row_security") {
+			if c.get("row_security") == "true" {
+				fmt.Printf("ALTER TABLE %s.%s ENABLE ROW LEVEL SECURITY;\n", c2.get("schema_name"), c.get("table_name"))
+			} else {
+				fmt.Printf("ALTER TABLE %s.%s DISABLE ROW LEVEL SECURITY;\n", c2.get("schema_name"), c.get("table_name"))
+			}
+		}
+		if c.get("force_row_security") != c2.get("force_row_security") {
+			if c.get("force_row_security") == "true" {
+				fmt.Printf("ALTER TABLE %s.%s FORCE ROW LEVEL SECURITY;\n", c2.get("schema_name"), c.get("table_name"))
+			} else {
+				fmt.Printf("ALTER TABLE %s.%s NO FORCE ROW LEVEL SECURITY;\n", c2.get("schema_name"), c.get("table_name"))
+			}
+		}
+		return
+	}
+
+	// The command and permissive-ness of a policy cannot be altered, and neither
+	// can an expression be removed, so those changes require a new policy
+	if c.get("command") != c2.get("command") ||
+		c.get("permissive") != c2.get("permissive") ||
+		(c.get("using_expr") == "null" && c2.get("using_expr") != "null") ||
+		(c.get("check_expr") == "null" && c2.get("check_expr") != "null") {
+		fmt.Printf("-- This policy is different so we'll drop and recreate it:\n")
+		c2.Drop()
+		c.createPolicy(c2.get("schema_name"))
+		return
+	}
+
+	alterSql := ""
+	if c.get("roles") != c2.get("roles") {
+		alterSql += " TO " + c.get("roles")
+	}
+	if c.get("using_expr") != c2.get("using_expr") {
+		alterSql += fmt.Sprintf(" USING (%s)", c.get("using_expr"))
+	}
+	if c.get("check_expr") != c2.get("check_expr") {
+		alterSql += fmt.Sprintf(" WITH CHECK (%s)", c.get("check_expr"))
+	}
+	if len(alterSql) > 0 {
+		fmt.Printf("ALTER POLICY %s ON %s.%s%s;\n", c.get("policy_name"), c2.get("schema_name"), c.get("table_name"), alterSql)
+	}
+}
+
+// ComparePolicies outputs SQL to make the row level security policies (and flags) match between DBs or schemas
+func ComparePolicies(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	policySqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	policySqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(PolicyRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(PolicyRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &PolicySchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &PolicySchema{rows: rows2, rowNum: -1}
+
+	// Compare the policies
+	DoDiff(schema1, schema2)
+}
@@ -7,16 +7,71 @@
 package pkg
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
-	"regexp"
+	"os"
 	"sort"
 	"strings"
+	"text/template"
 
 	"github.com/jiapeish/pgdiff/pgutil"
 )
 
-var curlyBracketRegex = regexp.MustCompile("[{}]")
+var (
+	referencedRoleSqlTemplate = initReferencedRoleSqlTemplate()
+)
+
+// rolePasswords1 and rolePasswords2 hold the password verifiers from pg_authid when --role-passwords is copy
+var rolePasswords1 = make(map[string]string)
+var rolePasswords2 = make(map[string]string)
+
+// rolePasswordFile receives the generated passwords when --role-passwords is random
+var rolePasswordFile *os.File
+
+// Initializes the Sql template that selects the roles owning, or holding privileges on, objects in the schemas being compared
+func initReferencedRoleSqlTemplate() *template.Template {
+	sql := `
+SELECT DISTINCT pg_catalog.pg_get_userbyid(x.role_oid) AS rolname
+FROM (
+    SELECT n.nspowner AS role_oid, n.nspname AS schema_name FROM pg_catalog.pg_namespace n
+    UNION ALL
+    SELECT (pg_catalog.aclexplode(n.nspacl)).grantee, n.nspname FROM pg_catalog.pg_namespace n
+    UNION ALL
+    SELECT c.relowner, n.nspname FROM pg_catalog.pg_class c INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+    UNION ALL
+    SELECT (pg_catalog.aclexplode(c.relacl)).grantee, n.nspname FROM pg_catalog.pg_class c INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+    UNION ALL
+    SELECT (pg_catalog.aclexplode(a.attacl)).grantee, n.nspname FROM pg_catalog.pg_attribute a
+        INNER JOIN pg_catalog.pg_class c ON (c.oid = a.attrelid)
+        INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+    UNION ALL
+    SELECT p.proowner, n.nspname FROM pg_catalog.pg_proc p INNER JOIN pg_catalog.pg_namespace n ON (n.oid = p.pronamespace)
+    UNION ALL
+    SELECT (pg_catalog.aclexplode(p.proacl)).grantee, n.nspname FROM pg_catalog.pg_proc p INNER JOIN pg_catalog.pg_namespace n ON (n.oid = p.pronamespace)
+    UNION ALL
+    SELECT t.typowner, n.nspname FROM pg_catalog.pg_type t INNER JOIN pg_catalog.pg_namespace n ON (n.oid = t.typnamespace)
+    UNION ALL
+    SELECT (pg_catalog.aclexplode(t.typacl)).grantee, n.nspname FROM pg_catalog.pg_type t INNER JOIN pg_catalog.pg_namespace n ON (n.oid = t.typnamespace)
+    UNION ALL
+    SELECT d.defaclrole, n.nspname FROM pg_catalog.pg_default_acl d INNER JOIN pg_catalog.pg_namespace n ON (n.oid = d.defaclnamespace)
+    UNION ALL
+    SELECT unnest(pol.polroles), n.nspname FROM pg_catalog.pg_policy pol
+        INNER JOIN pg_catalog.pg_class c ON (c.oid = pol.polrelid)
+        INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+) AS x
+WHERE x.role_oid <> 0
+{{if eq $.DbSchema "*" }}
+AND x.schema_name NOT LIKE 'pg_%'
+AND x.schema_name <> 'information_schema'
+{{else}}
+AND x.schema_name = '{{$.DbSchema}}'
+{{end}};
+`
+	t := template.New("ReferencedRoleSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
 
 // RoleRows is a sortable slice of string maps
 type RoleRows []map[string]string
@@ -91,10 +146,10 @@ where option can be:
       SUPERUSER | NOSUPERUSER
     | CREATEDB | NOCREATEDB
     | CREATEROLE | NOCREATEROLE
-    | CREATEUSER | NOCREATEUSER
     | INHERIT | NOINHERIT
     | LOGIN | NOLOGIN
     | REPLICATION | NOREPLICATION
+    | BYPASSRLS | NOBYPASSRLS
     | CONNECTION LIMIT connlimit
     | [ ENCRYPTED | UNENCRYPTED ] PASSWORD 'password'
     | VALID UNTIL 'timestamp'
@@ -106,11 +161,11 @@ where option can be:
     | SYSID uid
 */
 
-// Add generates SQL to add the constraint/index
+// Add generates SQL to add the role
 func (c RoleSchema) Add() {
 
 	// We don't care about efficiency here so we just concat strings
-	options := " WITH PASSWORD 'changeme'"
+	options := c.passwordOption()
 
 	if c.get("rolcanlogin") == "true" {
 		options += " LOGIN"
@@ -142,6 +197,10 @@ func (c RoleSchema) Add() {
 		options += " NOREPLICATION"
 	}
 
+	if c.get("rolbypassrls") == "true" {
+		options += " BYPASSRLS"
+	}
+
 	if c.get("rolconnlimit") != "-1" && len(c.get("rolconnlimit")) > 0 {
 		options += " CONNECTION LIMIT " + c.get("rolconnlimit")
 	}
@@ -150,6 +209,86 @@ func (c RoleSchema) Add() {
 	}
 
 	fmt.Printf("CREATE ROLE %s%s;\n", c.get("rolname"), options)
+
+	c.alterSettings(parseConfig(c.get("config")), parseConfig(c.get("db_config")), make(map[string]string), make(map[string]string))
+}
+
+// passwordOption returns the PASSWORD option for creating the role, according to --role-passwords.
+// The clear text of a password never appears in the SQL.
+func (c RoleSchema) passwordOption() string {
+	rolname := c.get("rolname")
+	switch RolePasswords {
+	case "random":
+		if c.get("rolcanlogin") != "true" {
+			return ""
+		}
+		password, err := pgutil.RandomPassword(24)
+		if err == nil {
+			err = writeRolePassword(rolname, password)
+		}
+		var verifier string
+		if err == nil {
+			verifier, err = pgutil.ScramSha256Verifier(password)
+		}
+		if err != nil {
+			fmt.Printf("-- WARNING: could not generate a password for role %s (%v).  Set one before it can log in.\n", rolname, err)
+			return ""
+		}
+		fmt.Printf("-- Notice!, the password for role %s is in %s\n", rolname, RolePasswordFile)
+		return fmt.Sprintf(" WITH PASSWORD '%s'", verifier)
+	case "copy":
+		if verifier, ok := rolePasswords1[rolname]; ok {
+			return fmt.Sprintf(" WITH PASSWORD '%s'", verifier)
+		}
+	}
+
+	if c.get("rolcanlogin") == "true" {
+		fmt.Printf("-- Notice!, role %s is created without a password.  Set one with ALTER ROLE %s PASSWORD before it can log in.\n", rolname, rolname)
+	}
+	return ""
+}
+
+// writeRolePassword appends the role's generated password to the --role-password-file,
+// which is created (readable only by its owner) the first time it is needed
+func writeRolePassword(rolname string, password string) error {
+	if rolePasswordFile == nil {
+		f, err := os.OpenFile(RolePasswordFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		rolePasswordFile = f
+	}
+	_, err := fmt.Fprintf(rolePasswordFile, "%s:%s\n", rolname, password)
+	return err
+}
+
+// loadRolePasswords returns the password verifiers from pg_authid, which only superusers can read
+func loadRolePasswords(conn *sql.DB, dbName string) map[string]string {
+	passwords := make(map[string]string)
+	rows, err := conn.Query("SELECT rolname, rolpassword FROM pg_catalog.pg_authid WHERE rolpassword IS NOT NULL;")
+	if err != nil {
+		fmt.Printf("-- WARNING: could not read the role passwords in %s, so none are copied: %v\n", dbName, err)
+		return passwords
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rolname, rolpassword string
+		if err := rows.Scan(&rolname, &rolpassword); err == nil {
+			passwords[rolname] = rolpassword
+		}
+	}
+	return passwords
+}
+
+// alterSettings prints the ALTER ROLE statements that change the role's configuration settings (for all
+// databases, and for the database being compared) from config2 and dbConfig2 to config1 and dbConfig1
+func (c RoleSchema) alterSettings(config1, dbConfig1, config2, dbConfig2 map[string]string) {
+	for _, action := range configChanges(config1, config2) {
+		fmt.Printf("ALTER ROLE %s %s;\n", c.get("rolname"), action)
+	}
+	for _, action := range configChanges(dbConfig1, dbConfig2) {
+		fmt.Printf("ALTER ROLE %s IN DATABASE %s %s;\n", c.get("rolname"), DbInfo2.DbName, action)
+	}
 }
 
 // Drop generates SQL to drop the role
@@ -197,14 +336,6 @@ func (c RoleSchema) Change(obj interface{}) {
 		}
 	}
 
-	if c.get("rolcreateuser") != c2.get("rolcreateuser") {
-		if c.get("rolcreateuser") == "true" {
-			options += " CREATEUSER"
-		} else {
-			options += " NOCREATEUSER"
-		}
-	}
-
 	if c.get("rolinherit") != c2.get("rolinherit") {
 		if c.get("rolinherit") == "true" {
 			options += " INHERIT"
@@ -221,6 +352,14 @@ func (c RoleSchema) Change(obj interface{}) {
 		}
 	}
 
+	if c.get("rolbypassrls") != c2.get("rolbypassrls") {
+		if c.get("rolbypassrls") == "true" {
+			options += " BYPASSRLS"
+		} else {
+			options += " NOBYPASSRLS"
+		}
+	}
+
 	if c.get("rolconnlimit") != c2.get("rolconnlimit") {
 		if len(c.get("rolconnlimit")) > 0 {
 			options += " CONNECTION LIMIT " + c.get("rolconnlimit")
@@ -230,6 +369,9 @@ func (c RoleSchema) Change(obj interface{}) {
 	if c.get("rolvaliduntil") != c2.get("rolvaliduntil") {
 		if c.get("rolvaliduntil") != "null" {
 			options += fmt.Sprintf(" VALID UNTIL '%s'", c.get("rolvaliduntil"))
+		} else if c2.get("rolvaliduntil") != "infinity" {
+			// A password that never expires
+			options += " VALID UNTIL 'infinity'"
 		}
 	}
 
@@ -238,31 +380,127 @@ func (c RoleSchema) Change(obj interface{}) {
 		fmt.Printf("ALTER ROLE %s%s;\n", c.get("rolname"), options)
 	}
 
-	if c.get("memberof") != c2.get("memberof") {
-		fmt.Println(c.get("memberof"), "!=", c2.get("memberof"))
-
-		// Remove the curly brackets
-		memberof1 := curlyBracketRegex.ReplaceAllString(c.get("memberof"), "")
-		memberof2 := curlyBracketRegex.ReplaceAllString(c2.get("memberof"), "")
+	if RolePasswords == "copy" {
+		verifier, ok := rolePasswords1[c.get("rolname")]
+		if ok && verifier != rolePasswords2[c.get("rolname")] {
+			fmt.Printf("ALTER ROLE %s PASSWORD '%s';\n", c.get("rolname"), verifier)
+		}
+	}
 
-		// Split
-		membersof1 := strings.Split(memberof1, ",")
-		membersof2 := strings.Split(memberof2, ",")
+	c.alterSettings(parseConfig(c.get("config")), parseConfig(c.get("db_config")), parseConfig(c2.get("config")), parseConfig(c2.get("db_config")))
+
+	// Membership changes wait until all the roles have been created (and before none of them are dropped)
+	memberships1 := c.memberships()
+	memberships2 := c2.memberships()
+	for _, role := range sortedMembershipKeys(memberships1) {
+		m1 := memberships1[role]
+		m2, ok := memberships2[role]
+		if !ok {
+			deferMembershipChange(role, c.grantMembership(role, m1))
+			continue
+		}
 
-		// TODO: Define INHERIT or not
-		for _, mo1 := range membersof1 {
-			if !pgutil.ContainsString(membersof2, mo1) {
-				fmt.Printf("GRANT %s TO %s;\n", mo1, c.get("rolname"))
+		if m1.admin != m2.admin {
+			if m1.admin == "true" {
+				deferMembershipChange(role, fmt.Sprintf("GRANT %s TO %s WITH ADMIN OPTION;", role, c.get("rolname")))
+			} else {
+				deferMembershipChange(role, fmt.Sprintf("REVOKE ADMIN OPTION FOR %s FROM %s;", role, c.get("rolname")))
 			}
 		}
-
-		for _, mo2 := range membersof2 {
-			if !pgutil.ContainsString(membersof1, mo2) {
-				fmt.Printf("REVOKE %s FROM %s;\n", mo2, c.get("rolname"))
+		// The INHERIT and SET options are only known when both servers are PostgreSQL 16 or later
+		if len(m1.inherit) > 0 && len(m2.inherit) > 0 && m1.inherit != m2.inherit {
+			if m1.inherit == "true" {
+				deferMembershipChange(role, fmt.Sprintf("GRANT %s TO %s WITH INHERIT TRUE;", role, c.get("rolname")))
+			} else {
+				deferMembershipChange(role, fmt.Sprintf("REVOKE INHERIT OPTION FOR %s FROM %s;", role, c.get("rolname")))
+			}
+		}
+		if len(m1.set) > 0 && len(m2.set) > 0 && m1.set != m2.set {
+			if m1.set == "true" {
+				deferMembershipChange(role, fmt.Sprintf("GRANT %s TO %s WITH SET TRUE;", role, c.get("rolname")))
+			} else {
+				deferMembershipChange(role, fmt.Sprintf("REVOKE SET OPTION FOR %s FROM %s;", role, c.get("rolname")))
 			}
 		}
+	}
+
+	for _, role := range sortedMembershipKeys(memberships2) {
+		if _, ok := memberships1[role]; !ok {
+			deferMembershipChange(role, fmt.Sprintf("REVOKE %s FROM %s;", role, c.get("rolname")))
+		}
+	}
+}
+
+// membershipChange is a GRANT or REVOKE statement for a membership in the given role
+type membershipChange struct {
+	role      string
+	statement string
+}
+
+// membershipChanges holds the membership changes of the compared roles, which CompareRoles
+// prints once DoDiff has created and dropped the roles
+var membershipChanges []membershipChange
+
+// deferMembershipChange holds the membership statement until CompareRoles prints it
+func deferMembershipChange(role string, statement string) {
+	membershipChanges = append(membershipChanges, membershipChange{role: role, statement: statement})
+}
+
+// roleMembership holds the options of a role's membership in another role.  Each one is "true" or "false",
+// except inherit and set, which are empty when the server does not track them (before PostgreSQL 16).
+type roleMembership struct {
+	admin   string
+	inherit string
+	set     string
+}
+
+// memberships returns the role's memberships in other roles, keyed by the name of the other role
+func (c RoleSchema) memberships() map[string]roleMembership {
+	memberships := make(map[string]roleMembership)
+	if c.get("memberof") == "null" || len(c.get("memberof")) == 0 {
+		return memberships
+	}
+	for _, line := range strings.Split(c.get("memberof"), "\n") {
+		// admin|inherit|set|role name (the name goes last as it may contain anything)
+		parts := strings.SplitN(line, "|", 4)
+		if len(parts) == 4 {
+			memberships[parts[3]] = roleMembership{admin: parts[0], inherit: parts[1], set: parts[2]}
+		}
+	}
+	return memberships
+}
+
+// sortedMembershipKeys returns the role names of the memberships in order
+func sortedMembershipKeys(memberships map[string]roleMembership) []string {
+	keys := make([]string, 0, len(memberships))
+	for key := range memberships {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
 
+// grantMembership returns SQL to make this role a member of the given role, naming only the
+// options that differ from their defaults so the statement still works before PostgreSQL 16
+func (c RoleSchema) grantMembership(role string, m roleMembership) string {
+	options := []string{}
+	if m.admin == "true" {
+		options = append(options, "ADMIN TRUE")
 	}
+	if len(m.inherit) > 0 && m.inherit != c.get("rolinherit") {
+		options = append(options, "INHERIT "+strings.ToUpper(m.inherit))
+	}
+	if m.set == "false" {
+		options = append(options, "SET FALSE")
+	}
+
+	with := ""
+	if len(options) == 1 && m.admin == "true" {
+		with = " WITH ADMIN OPTION"
+	} else if len(options) > 0 {
+		with = " WITH " + strings.Join(options, ", ")
+	}
+	return fmt.Sprintf("GRANT %s TO %s%s;", role, c.get("rolname"), with)
 }
 
 /*
@@ -279,25 +517,50 @@ SELECT r.rolname
     , r.rolconnlimit
     , r.rolvaliduntil
     , r.rolreplication
-	, ARRAY(SELECT b.rolname 
-	        FROM pg_catalog.pg_auth_members m  
-			JOIN pg_catalog.pg_roles b ON (m.roleid = b.oid)  
-	        WHERE m.member = r.oid) as memberof
+    , r.rolbypassrls
+    , (SELECT array_to_string(s.setconfig, E'\n') FROM pg_catalog.pg_db_role_setting s
+        WHERE s.setrole = r.oid AND s.setdatabase = 0) AS config
+    , (SELECT array_to_string(s.setconfig, E'\n') FROM pg_catalog.pg_db_role_setting s
+        WHERE s.setrole = r.oid AND s.setdatabase = (SELECT d.oid FROM pg_catalog.pg_database d WHERE d.datname = current_database())) AS db_config
+    , array_to_string(ARRAY(
+        SELECT m.admin_option::text || '|' || COALESCE(to_jsonb(m) ->> 'inherit_option', '')
+            || '|' || COALESCE(to_jsonb(m) ->> 'set_option', '') || '|' || b.rolname
+        FROM pg_catalog.pg_auth_members m
+        JOIN pg_catalog.pg_roles b ON (m.roleid = b.oid)
+        WHERE m.member = r.oid
+        ORDER BY b.rolname), E'\n') AS memberof
 FROM pg_catalog.pg_roles AS r
+WHERE r.rolname !~ '^pg_'
 ORDER BY r.rolname;
 `
+	include := roleFilter(conn1, conn2)
+
+	switch RolePasswords {
+	case "none", "random":
+	case "copy":
+		rolePasswords1 = loadRolePasswords(conn1, DbInfo1.DbName)
+		rolePasswords2 = loadRolePasswords(conn2, DbInfo2.DbName)
+	default:
+		fmt.Printf("-- Error!!!, --role-passwords must be none, random or copy, not %s.  Using none.\n", RolePasswords)
+		RolePasswords = "none"
+	}
+
 	rowChan1, _ := pgutil.QueryStrings(conn1, sql)
 	rowChan2, _ := pgutil.QueryStrings(conn2, sql)
 
 	rows1 := make(RoleRows, 0)
 	for row := range rowChan1 {
-		rows1 = append(rows1, row)
+		if include(row["rolname"]) {
+			rows1 = append(rows1, row)
+		}
 	}
 	sort.Sort(rows1)
 
 	rows2 := make(RoleRows, 0)
 	for row := range rowChan2 {
-		rows2 = append(rows2, row)
+		if include(row["rolname"]) {
+			rows2 = append(rows2, row)
+		}
 	}
 	sort.Sort(rows2)
 
@@ -306,5 +569,95 @@ ORDER BY r.rolname;
 	var schema2 Schema = &RoleSchema{rows: rows2, rowNum: -1}
 
 	// Compare the roles
+	membershipChanges = nil
 	DoDiff(schema1, schema2)
+
+	// Memberships are granted and revoked once all the roles exist.  Dropping a role
+	// already removed the memberships in it.
+	names1 := make(map[string]bool)
+	for _, row := range rows1 {
+		names1[row["rolname"]] = true
+	}
+	names2 := make(map[string]bool)
+	for _, row := range rows2 {
+		names2[row["rolname"]] = true
+	}
+	for _, change := range membershipChanges {
+		if names2[change.role] && !names1[change.role] {
+			continue
+		}
+		fmt.Println(change.statement)
+	}
+
+	// Added roles are made members of other roles too
+	for i, row := range rows1 {
+		if !names2[row["rolname"]] {
+			added := RoleSchema{rows: rows1, rowNum: i}
+			memberships := added.memberships()
+			for _, role := range sortedMembershipKeys(memberships) {
+				fmt.Println(added.grantMembership(role, memberships[role]))
+			}
+		}
+	}
+
+	compareDatabaseSettings(conn1, conn2)
+}
+
+// roleFilter returns a function telling whether a role should be compared, based on the --role-pattern
+// and --referenced-roles options.  A role referenced in either database is compared in both.
+func roleFilter(conn1 *sql.DB, conn2 *sql.DB) func(string) bool {
+	var referenced map[string]bool
+	if ReferencedRolesOnly {
+		referenced = make(map[string]bool)
+
+		buf1 := new(bytes.Buffer)
+		referencedRoleSqlTemplate.Execute(buf1, DbInfo1)
+		rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+		for row := range rowChan1 {
+			referenced[row["rolname"]] = true
+		}
+
+		buf2 := new(bytes.Buffer)
+		referencedRoleSqlTemplate.Execute(buf2, DbInfo2)
+		rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+		for row := range rowChan2 {
+			referenced[row["rolname"]] = true
+		}
+	}
+
+	return func(rolname string) bool {
+		if RolePattern != nil && !RolePattern.MatchString(rolname) {
+			return false
+		}
+		if referenced != nil && !referenced[rolname] {
+			return false
+		}
+		return true
+	}
+}
+
+// compareDatabaseSettings outputs SQL to make the configuration settings of the database being
+// compared (those set with ALTER DATABASE, which apply to all roles) match
+func compareDatabaseSettings(conn1 *sql.DB, conn2 *sql.DB) {
+	sql := `
+SELECT array_to_string(s.setconfig, E'\n') AS config
+FROM pg_catalog.pg_db_role_setting s
+WHERE s.setrole = 0
+AND s.setdatabase = (SELECT d.oid FROM pg_catalog.pg_database d WHERE d.datname = current_database());
+`
+	config1 := make(map[string]string)
+	rowChan1, _ := pgutil.QueryStrings(conn1, sql)
+	for row := range rowChan1 {
+		config1 = parseConfig(row["config"])
+	}
+
+	config2 := make(map[string]string)
+	rowChan2, _ := pgutil.QueryStrings(conn2, sql)
+	for row := range rowChan2 {
+		config2 = parseConfig(row["config"])
+	}
+
+	for _, action := range configChanges(config1, config2) {
+		fmt.Printf("ALTER DATABASE %s %s;\n", DbInfo2.DbName, action)
+	}
 }
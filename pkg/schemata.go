@@ -111,6 +111,7 @@ SELECT schema_name
 FROM information_schema.schemata
 WHERE schema_name NOT LIKE 'pg_%' 
   AND schema_name <> 'information_schema' 
+  AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_namespace'::regclass AND d.objid = quote_ident(schema_name)::regnamespace AND d.deptype = 'e')
 ORDER BY schema_name;`
 
 	rowChan1, _ := pgutil.QueryStrings(conn1, sql)
@@ -11,6 +11,7 @@ import (
 	"database/sql"
 	"fmt"
 	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/jiapeish/pgdiff/pgutil"
@@ -21,24 +22,39 @@ var (
 )
 
 // Initializes the Sql template
+//
+// Identity sequences are left out because they belong to (and are changed with) their column.
+// last_value is null when the sequence has not been used yet.
 func initSequenceSqlTemplate() *template.Template {
 	sql := `
-SELECT sequence_schema AS schema_name
-    , {{if eq $.DbSchema "*" }}sequence_schema || '.' || {{end}}sequence_name AS compare_name
-    , sequence_name 
-	, data_type
-	, start_value
-	, minimum_value
-	, maximum_value
-	, increment
-	, cycle_option 
-FROM information_schema.sequences
+SELECT s.schemaname AS schema_name
+    , {{if eq $.DbSchema "*" }}s.schemaname || '.' || {{end}}s.sequencename AS compare_name
+    , s.sequencename AS sequence_name
+	, s.data_type
+	, s.start_value
+	, s.min_value AS minimum_value
+	, s.max_value AS maximum_value
+	, s.increment_by AS increment
+	, s.cycle AS cycle_option
+	, s.cache_size
+	, s.last_value
+	, own_n.nspname AS owned_by_schema
+	, own_c.relname AS owned_by_table
+	, own_a.attname AS owned_by_column
+FROM pg_catalog.pg_sequences s
+INNER JOIN pg_catalog.pg_namespace n ON (n.nspname = s.schemaname)
+INNER JOIN pg_catalog.pg_class c ON (c.relnamespace = n.oid AND c.relname = s.sequencename)
+LEFT OUTER JOIN pg_catalog.pg_depend own ON (own.classid = 'pg_class'::regclass AND own.objid = c.oid AND own.refclassid = 'pg_class'::regclass AND own.deptype = 'a')
+LEFT OUTER JOIN pg_catalog.pg_class own_c ON (own_c.oid = own.refobjid)
+LEFT OUTER JOIN pg_catalog.pg_namespace own_n ON (own_n.oid = own_c.relnamespace)
+LEFT OUTER JOIN pg_catalog.pg_attribute own_a ON (own_a.attrelid = own.refobjid AND own_a.attnum = own.refobjsubid)
 WHERE true
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype IN ('e', 'i'))
 {{if eq $.DbSchema "*" }}
-AND sequence_schema NOT LIKE 'pg_%' 
-AND sequence_schema <> 'information_schema' 
+AND s.schemaname NOT LIKE 'pg_%' 
+AND s.schemaname <> 'information_schema' 
 {{else}}
-AND sequence_schema = '{{$.DbSchema}}'
+AND s.schemaname = '{{$.DbSchema}}'
 {{end}}
 `
 
@@ -105,13 +121,55 @@ func (c *SequenceSchema) Compare(obj interface{}) int {
 	return val
 }
 
+// ownedBy returns the table column (in the given schema) that owns the sequence, or NONE
+func (c SequenceSchema) ownedBy(schema string) string {
+	if c.get("owned_by_table") == "null" {
+		return "NONE"
+	}
+	// A sequence owned by a table in its own schema moves along with the schema being compared
+	ownerSchema := c.get("owned_by_schema")
+	if ownerSchema == c.get("schema_name") {
+		ownerSchema = schema
+	}
+	return fmt.Sprintf("%s.%s.%s", ownerSchema, c.get("owned_by_table"), c.get("owned_by_column"))
+}
+
+// cycle returns the CYCLE or NO CYCLE option of the sequence
+func (c SequenceSchema) cycle() string {
+	if c.get("cycle_option") == "true" {
+		return "CYCLE"
+	}
+	return "NO CYCLE"
+}
+
+// syncValue prints SQL that sets the sequence in db2 to the current value of the sequence in db1.
+// lastValue2 is the last value of the sequence in db2 (or null when it is unused or new).
+func (c SequenceSchema) syncValue(schema string, lastValue2 string) {
+	if c.get("last_value") == lastValue2 {
+		return
+	}
+	if c.get("last_value") == "null" {
+		// The sequence is unused in db1, so the next value should be the start value
+		fmt.Printf("SELECT pg_catalog.setval('%s.%s', %s, false);\n", schema, c.get("sequence_name"), c.get("start_value"))
+	} else {
+		fmt.Printf("SELECT pg_catalog.setval('%s.%s', %s, true);\n", schema, c.get("sequence_name"), c.get("last_value"))
+	}
+}
+
 // Add returns SQL to add the sequence
 func (c SequenceSchema) Add() {
 	schema := DbInfo2.DbSchema
 	if schema == "*" {
 		schema = c.get("schema_name")
 	}
-	fmt.Printf("CREATE SEQUENCE %s.%s INCREMENT %s MINVALUE %s MAXVALUE %s START %s;\n", schema, c.get("sequence_name"), c.get("increment"), c.get("minimum_value"), c.get("maximum_value"), c.get("start_value"))
+	fmt.Printf("CREATE SEQUENCE %s.%s AS %s INCREMENT %s MINVALUE %s MAXVALUE %s START %s CACHE %s %s;\n", schema, c.get("sequence_name"), c.get("data_type"), c.get("increment"), c.get("minimum_value"), c.get("maximum_value"), c.get("start_value"), c.get("cache_size"), c.cycle())
+	if c.get("owned_by_table") != "null" {
+		// The owning table is usually created later (by the TABLE schema type)
+		fmt.Printf("-- Notice!, %s.%s is owned by %s.  Once that table exists, run pgdiff with the SEQUENCE option again to add OWNED BY.\n", schema, c.get("sequence_name"), c.ownedBy(schema))
+	}
+	if SyncSequenceValues {
+		c.syncValue(schema, "null")
+	}
 }
 
 // Drop returns SQL to drop the sequence
@@ -119,13 +177,47 @@ func (c SequenceSchema) Drop() {
 	fmt.Printf("DROP SEQUENCE %s.%s;\n", c.get("schema_name"), c.get("sequence_name"))
 }
 
-// Change doesn't do anything right now.
+// Change handles the case where the sequence names match, but the options (or values) do not
 func (c SequenceSchema) Change(obj interface{}) {
 	c2, ok := obj.(*SequenceSchema)
 	if !ok {
 		fmt.Println("Error!!!, Change(obj) needs a SequenceSchema instance", c2)
 	}
-	// Don't know of anything helpful we should do here
+
+	schema := c2.get("schema_name")
+
+	options := []string{}
+	if c.get("data_type") != c2.get("data_type") {
+		options = append(options, "AS "+c.get("data_type"))
+	}
+	if c.get("increment") != c2.get("increment") {
+		options = append(options, "INCREMENT BY "+c.get("increment"))
+	}
+	if c.get("minimum_value") != c2.get("minimum_value") {
+		options = append(options, "MINVALUE "+c.get("minimum_value"))
+	}
+	if c.get("maximum_value") != c2.get("maximum_value") {
+		options = append(options, "MAXVALUE "+c.get("maximum_value"))
+	}
+	if c.get("start_value") != c2.get("start_value") {
+		options = append(options, "START WITH "+c.get("start_value"))
+	}
+	if c.get("cache_size") != c2.get("cache_size") {
+		options = append(options, "CACHE "+c.get("cache_size"))
+	}
+	if c.get("cycle_option") != c2.get("cycle_option") {
+		options = append(options, c.cycle())
+	}
+	if c.ownedBy(schema) != c2.ownedBy(schema) {
+		options = append(options, "OWNED BY "+c.ownedBy(schema))
+	}
+	if len(options) > 0 {
+		fmt.Printf("ALTER SEQUENCE %s.%s %s;\n", schema, c.get("sequence_name"), strings.Join(options, " "))
+	}
+
+	if SyncSequenceValues {
+		c.syncValue(schema, c2.get("last_value"))
+	}
 }
 
 // compareSequences outputs SQL to make the sequences match between DBs or schemas
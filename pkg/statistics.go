@@ -0,0 +1,212 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	statisticsSqlTemplate = initStatisticsSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// qualified_name is how pg_get_statisticsobjdef names the statistics object, so the definition
+// can be split into the part between the name and the table, e.g. "(ndistinct) ON a, b".
+func initStatisticsSqlTemplate() *template.Template {
+	sql := `
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}s.stxname AS compare_name
+    , s.stxname AS statistics_name
+    , quote_ident(n.nspname) || '.' || quote_ident(s.stxname) AS qualified_name
+    , tn.nspname AS table_schema
+    , c.relname AS table_name
+    , pg_catalog.pg_get_statisticsobjdef(s.oid) AS definition
+    -- stxstattarget is null rather than -1 for the default in PostgreSQL 17 and later
+    , COALESCE((to_jsonb(s) ->> 'stxstattarget')::integer, -1) AS statistics_target
+FROM pg_catalog.pg_statistic_ext s
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = s.stxnamespace)
+INNER JOIN pg_catalog.pg_class c ON (c.oid = s.stxrelid)
+INNER JOIN pg_catalog.pg_namespace tn ON (tn.oid = c.relnamespace)
+WHERE NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_statistic_ext'::regclass AND d.objid = s.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}};
+`
+	t := template.New("StatisticsSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// StatisticsRows definition
+// ==================================
+
+// StatisticsRows is a sortable slice of string maps
+type StatisticsRows []map[string]string
+
+func (slice StatisticsRows) Len() int {
+	return len(slice)
+}
+
+func (slice StatisticsRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice StatisticsRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ==================================
+// StatisticsSchema definition
+// (implements Schema -- defined in pgdiff.go)
+// ==================================
+
+// StatisticsSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+type StatisticsSchema struct {
+	rows   StatisticsRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *StatisticsSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *StatisticsSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *StatisticsSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*StatisticsSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare needs a StatisticsSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// columns returns the kinds and columns (or expressions) of the statistics object, without its name or table
+func (c *StatisticsSchema) columns() string {
+	columns := strings.TrimPrefix(c.get("definition"), "CREATE STATISTICS "+c.get("qualified_name")+" ")
+	if i := strings.LastIndex(columns, " FROM "); i >= 0 {
+		columns = columns[:i]
+	}
+	return columns
+}
+
+// tableSchema returns the schema of the table in db1's row, mapped to db2's schema when
+// comparing two schemas (a table in any other schema is left as it is)
+func (c *StatisticsSchema) tableSchema() string {
+	tableSchema := c.get("table_schema")
+	if DbInfo1.DbSchema != DbInfo2.DbSchema && tableSchema == DbInfo1.DbSchema {
+		tableSchema = DbInfo2.DbSchema
+	}
+	return tableSchema
+}
+
+// create prints SQL to create the statistics object in the given schema
+func (c *StatisticsSchema) create(schema string) {
+	fmt.Printf("CREATE STATISTICS %s.%s %s FROM %s.%s;\n", schema, c.get("statistics_name"), c.columns(), c.tableSchema(), c.get("table_name"))
+	if c.get("statistics_target") != "-1" {
+		fmt.Printf("ALTER STATISTICS %s.%s SET STATISTICS %s;\n", schema, c.get("statistics_name"), c.get("statistics_target"))
+	}
+}
+
+// Add prints SQL to add the statistics object
+func (c *StatisticsSchema) Add() {
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+	c.create(schema)
+}
+
+// Drop prints SQL to drop the statistics object
+func (c *StatisticsSchema) Drop() {
+	fmt.Printf("DROP STATISTICS %s.%s;\n", c.get("schema_name"), c.get("statistics_name"))
+}
+
+// Change handles the case where the statistics object names match, but the definitions do not
+func (c *StatisticsSchema) Change(obj interface{}) {
+	c2, ok := obj.(*StatisticsSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a StatisticsSchema instance", c2)
+		return
+	}
+
+	// Only the statistics target, name, owner and schema of a statistics object can be altered
+	if c.columns() != c2.columns() || c.tableSchema() != c2.get("table_schema") || c.get("table_name") != c2.get("table_name") {
+		fmt.Println("-- This statistics object is different so we'll drop and recreate it:")
+		c2.Drop()
+		c.create(c2.get("schema_name"))
+		return
+	}
+
+	if c.get("statistics_target") != c2.get("statistics_target") {
+		fmt.Printf("ALTER STATISTICS %s.%s SET STATISTICS %s;\n", c2.get("schema_name"), c2.get("statistics_name"), c.get("statistics_target"))
+	}
+}
+
+// ==================================
+// Functions
+// ==================================
+
+// CompareStatistics outputs SQL to make the extended statistics objects match between DBs or schemas
+func CompareStatistics(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	statisticsSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	statisticsSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(StatisticsRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(StatisticsRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &StatisticsSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &StatisticsSchema{rows: rows2, rowNum: -1}
+
+	DoDiff(schema1, schema2)
+}
@@ -0,0 +1,278 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	storageSqlTemplate = initStorageSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// Each table and index has a row with its tablespace and storage parameters (those of its TOAST
+// table are prefixed with "toast.").  A null tablespace is the database's default tablespace.  Each table column has a row with its storage, compression and
+// statistics target.  Materialized views are left to MATVIEW, which recreates them as a whole.
+func initStorageSqlTemplate() *template.Template {
+	sql := `
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS compare_name
+    , c.relname AS relation_name
+    , NULL AS column_name
+    , CASE WHEN c.relkind = 'i' THEN 'INDEX' ELSE 'TABLE' END AS object_type
+    , ts.spcname AS tablespace
+    , (SELECT dts.spcname FROM pg_catalog.pg_database d INNER JOIN pg_catalog.pg_tablespace dts ON (dts.oid = d.dattablespace)
+       WHERE d.datname = pg_catalog.current_database()) AS database_tablespace
+    , NULLIF(array_to_string(c.reloptions || ARRAY(
+        SELECT 'toast.' || unnest(tc.reloptions) FROM pg_catalog.pg_class tc WHERE tc.oid = c.reltoastrelid), ', '), '') AS storage_options
+    , NULL AS storage
+    , NULL AS type_storage
+    , NULL AS compression
+    , NULL AS statistics
+FROM pg_catalog.pg_class c
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+LEFT JOIN pg_catalog.pg_tablespace ts ON (ts.oid = c.reltablespace)
+WHERE c.relkind IN ('r', 'p', 'i')
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+UNION ALL
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname || '.' || a.attname AS compare_name
+    , c.relname AS relation_name
+    , a.attname AS column_name
+    , 'COLUMN' AS object_type
+    , NULL AS tablespace
+    , NULL AS database_tablespace
+    , NULL AS storage_options
+    , CASE a.attstorage WHEN 'p' THEN 'PLAIN' WHEN 'e' THEN 'EXTERNAL' WHEN 'm' THEN 'MAIN' ELSE 'EXTENDED' END AS storage
+    , CASE t.typstorage WHEN 'p' THEN 'PLAIN' WHEN 'e' THEN 'EXTERNAL' WHEN 'm' THEN 'MAIN' ELSE 'EXTENDED' END AS type_storage
+    -- attcompression only exists in PostgreSQL 14 and later
+    , CASE to_jsonb(a) ->> 'attcompression' WHEN 'p' THEN 'pglz' WHEN 'l' THEN 'lz4' ELSE 'default' END AS compression
+    -- attstattarget is null rather than -1 for the default in PostgreSQL 17 and later
+    , COALESCE((to_jsonb(a) ->> 'attstattarget')::integer, -1) AS statistics
+FROM pg_catalog.pg_attribute a
+INNER JOIN pg_catalog.pg_class c ON (c.oid = a.attrelid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+INNER JOIN pg_catalog.pg_type t ON (t.oid = a.atttypid)
+WHERE c.relkind IN ('r', 'p')
+AND a.attnum > 0
+AND NOT a.attisdropped
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}};
+`
+	t := template.New("StorageSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// StorageRows definition
+// ==================================
+
+// StorageRows is a sortable slice of string maps
+type StorageRows []map[string]string
+
+func (slice StorageRows) Len() int {
+	return len(slice)
+}
+
+func (slice StorageRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice StorageRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// ==================================
+// StorageSchema definition
+// (implements Schema -- defined in pgdiff.go)
+// ==================================
+
+// StorageSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+type StorageSchema struct {
+	rows   StorageRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *StorageSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *StorageSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *StorageSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*StorageSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare needs a StorageSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// Add prints SQL that gives a new index or column (created by INDEX or COLUMN) the storage
+// settings that differ from the defaults.  TABLE creates a new table in its tablespace and with
+// its storage parameters already.
+func (c *StorageSchema) Add() {
+	if c.get("object_type") == "TABLE" {
+		return
+	}
+
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+
+	if c.get("object_type") == "COLUMN" {
+		c.alterColumn(schema, map[string]string{"storage": c.get("type_storage"), "compression": "default", "statistics": "-1"})
+		return
+	}
+
+	name := fmt.Sprintf("%s.%s", schema, c.get("relation_name"))
+	if c.get("tablespace") != "null" {
+		fmt.Printf("ALTER %s %s SET TABLESPACE %s;\n", c.get("object_type"), name, c.get("tablespace"))
+	}
+	if c.get("storage_options") != "null" {
+		fmt.Printf("ALTER %s %s SET (%s);\n", c.get("object_type"), name, c.get("storage_options"))
+	}
+}
+
+// Drop does nothing, because TABLE, INDEX or COLUMN drops the object itself
+func (c *StorageSchema) Drop() {
+}
+
+// Change handles the case where the table, index or column names match, but the storage settings do not
+func (c *StorageSchema) Change(obj interface{}) {
+	c2, ok := obj.(*StorageSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a StorageSchema instance", c2)
+		return
+	}
+
+	if c.get("object_type") != c2.get("object_type") {
+		fmt.Printf("-- WARNING: %s is a %s in db1 but a %s in db2, so its storage is not compared.\n",
+			c.get("compare_name"), strings.ToLower(c.get("object_type")), strings.ToLower(c2.get("object_type")))
+		return
+	}
+
+	if c.get("object_type") == "COLUMN" {
+		c.alterColumn(c2.get("schema_name"), c2.rows[c2.rowNum])
+		return
+	}
+
+	name := fmt.Sprintf("%s.%s", c2.get("schema_name"), c2.get("relation_name"))
+	if c.get("tablespace") != c2.get("tablespace") {
+		tablespace := c.get("tablespace")
+		if tablespace == "null" {
+			tablespace = c2.get("database_tablespace")
+		}
+		fmt.Printf("ALTER %s %s SET TABLESPACE %s;\n", c.get("object_type"), name, tablespace)
+	}
+
+	if c.get("storage_options") != c2.get("storage_options") {
+		options1 := parseStorageOptions(c.get("storage_options"))
+		options2 := parseStorageOptions(c2.get("storage_options"))
+		resets := []string{}
+		for _, option := range sortedKeys(options2) {
+			if _, ok := options1[option]; !ok {
+				resets = append(resets, option)
+			}
+		}
+		if len(resets) > 0 {
+			fmt.Printf("ALTER %s %s RESET (%s);\n", c.get("object_type"), name, strings.Join(resets, ", "))
+		}
+		if c.get("storage_options") != "null" {
+			fmt.Printf("ALTER %s %s SET (%s);\n", c.get("object_type"), name, c.get("storage_options"))
+		}
+	}
+}
+
+// alterColumn prints the ALTER TABLE statements that change the column's storage, compression and
+// statistics target from the ones in row2 to the ones in the current row
+func (c *StorageSchema) alterColumn(schema string, row2 map[string]string) {
+	alter := fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s", schema, c.get("relation_name"), c.get("column_name"))
+	if c.get("storage") != row2["storage"] {
+		fmt.Printf("%s SET STORAGE %s;\n", alter, c.get("storage"))
+	}
+	if c.get("compression") != row2["compression"] {
+		fmt.Printf("%s SET COMPRESSION %s;\n", alter, c.get("compression"))
+	}
+	if c.get("statistics") != row2["statistics"] {
+		fmt.Printf("%s SET STATISTICS %s;\n", alter, c.get("statistics"))
+	}
+}
+
+// ==================================
+// Functions
+// ==================================
+
+// CompareStorage outputs SQL to make the tablespaces, storage parameters, column storage
+// and statistics targets of tables and indexes match between DBs or schemas
+func CompareStorage(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	storageSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	storageSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(StorageRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(StorageRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &StorageSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &StorageSchema{rows: rows2, rowNum: -1}
+
+	DoDiff(schema1, schema2)
+}
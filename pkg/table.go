@@ -11,33 +11,65 @@ import (
 	"database/sql"
 	"fmt"
 	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/jiapeish/pgdiff/pgutil"
 )
 
 var (
-	tableSqlTemplate = initTableSqlTemplate()
+	tableSqlTemplate           = initTableSqlTemplate()
+	tableColumnDefSqlTemplate  = initTableColumnDefSqlTemplate()
+	tableConstraintSqlTemplate = initTableConstraintSqlTemplate()
 )
 
+// db2Tables holds the tables (and partitions) that db2 has, keyed by compare_name, as
+// loaded by loadDb2Tables.  A db1 table that db2 does not have is created in full by
+// TABLE (or PARTITION), so other schema types know not to add its parts again.
+var db2Tables = make(map[string][]map[string]string)
+
+// inheritingTable is the CREATE TABLE statement of a table that inherits from other tables
+type inheritingTable struct {
+	name      string   // schema-qualified, as in db2
+	parents   []string // schema-qualified, as in db2
+	statement string
+}
+
+// inheritingTables holds the CREATE TABLE statements of the new tables that inherit from other
+// tables, which CompareTables prints once DoDiff has created the tables they inherit from
+var inheritingTables []inheritingTable
+
 // Initializes the Sql template
+//
+// inherits holds one schema-qualified table per line that the table inherits from (partitions
+// are left to PARTITION).
 func initTableSqlTemplate() *template.Template {
 
 	sql := `
-SELECT table_schema
-    , {{if eq $.DbSchema "*" }}table_schema || '.' || {{end}}table_name AS compare_name
-	, table_name
-    , CASE table_type 
-	  WHEN 'BASE TABLE' THEN 'TABLE' 
-	  ELSE table_type END AS table_type
-    , is_insertable_into
-FROM information_schema.tables 
-WHERE table_type = 'BASE TABLE'
+SELECT n.nspname AS table_schema
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS compare_name
+	, c.relname AS table_name
+    , 'TABLE' AS table_type
+    , c.relkind
+    , c.relispartition AS is_partition
+    , CASE WHEN c.relkind = 'p' THEN pg_catalog.pg_get_partkeydef(c.oid) END AS partition_key
+    , array_to_string(c.reloptions, ', ') AS reloptions
+    , ts.spcname AS tablespace
+    , (SELECT string_agg(pn.nspname || '.' || pc.relname, E'\n' ORDER BY i.inhseqno)
+       FROM pg_catalog.pg_inherits i
+       INNER JOIN pg_catalog.pg_class pc ON (pc.oid = i.inhparent)
+       INNER JOIN pg_catalog.pg_namespace pn ON (pn.oid = pc.relnamespace)
+       WHERE i.inhrelid = c.oid AND NOT c.relispartition) AS inherits
+FROM pg_catalog.pg_class c
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+LEFT OUTER JOIN pg_catalog.pg_tablespace ts ON (ts.oid = c.reltablespace)
+WHERE c.relkind IN ('r', 'p')
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
 {{if eq $.DbSchema "*" }}
-AND table_schema NOT LIKE 'pg_%' 
-AND table_schema <> 'information_schema' 
+AND n.nspname NOT LIKE 'pg_%' 
+AND n.nspname <> 'information_schema' 
 {{else}}
-AND table_schema = '{{$.DbSchema}}'
+AND n.nspname = '{{$.DbSchema}}'
 {{end}}
 ORDER BY compare_name;
 `
@@ -46,6 +78,77 @@ ORDER BY compare_name;
 	return t
 }
 
+// Initializes the Sql template for the columns of a CREATE TABLE statement
+//
+// Columns that a table only gets from the tables it inherits from are left out, and collation
+// is only set for a column whose collation is not its type's default.
+func initTableColumnDefSqlTemplate() *template.Template {
+
+	sql := `
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS compare_name
+    , a.attname AS column_name
+    , pg_catalog.format_type(a.atttypid, a.atttypmod) AS data_type
+    , CASE WHEN a.attcollation <> t.typcollation THEN quote_ident(cn.nspname) || '.' || quote_ident(co.collname) END AS collation
+    , a.attnotnull AS not_null
+    , pg_catalog.pg_get_expr(d.adbin, d.adrelid) AS column_default
+    , to_jsonb(a) ->> 'attgenerated' AS generated
+    , CASE a.attidentity
+      WHEN 'a' THEN 'ALWAYS'
+      WHEN 'd' THEN 'BY DEFAULT'
+      END AS identity_generation
+FROM pg_catalog.pg_attribute a
+INNER JOIN pg_catalog.pg_class c ON (c.oid = a.attrelid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+INNER JOIN pg_catalog.pg_type t ON (t.oid = a.atttypid)
+LEFT OUTER JOIN pg_catalog.pg_collation co ON (co.oid = a.attcollation)
+LEFT OUTER JOIN pg_catalog.pg_namespace cn ON (cn.oid = co.collnamespace)
+LEFT OUTER JOIN pg_catalog.pg_attrdef d ON (d.adrelid = a.attrelid AND d.adnum = a.attnum)
+WHERE c.relkind IN ('r', 'p')
+AND a.attnum > 0
+AND NOT a.attisdropped
+AND a.attislocal
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%' 
+AND n.nspname <> 'information_schema' 
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name, a.attnum;
+`
+	t := template.New("TableColumnDefSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// Initializes the Sql template for the (primary key, unique, and check) constraints
+// of a CREATE TABLE statement
+func initTableConstraintSqlTemplate() *template.Template {
+
+	sql := `
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS compare_name
+    , con.conname AS constraint_name
+    , pg_catalog.pg_get_constraintdef(con.oid, true) AS constraint_def
+FROM pg_catalog.pg_constraint con
+INNER JOIN pg_catalog.pg_class c ON (c.oid = con.conrelid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+WHERE c.relkind IN ('r', 'p')
+AND con.contype IN ('p', 'u', 'c')
+AND con.conislocal
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%' 
+AND n.nspname <> 'information_schema' 
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name
+    , CASE con.contype WHEN 'p' THEN 1 WHEN 'u' THEN 2 ELSE 3 END
+    , con.conname;
+`
+	t := template.New("TableConstraintSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
 // ==================================
 // TableRows definition
 // ==================================
@@ -70,9 +173,11 @@ func (slice TableRows) Swap(i, j int) {
 //
 // TableSchema implements the Schema interface defined in pgdiff.go
 type TableSchema struct {
-	rows   TableRows
-	rowNum int
-	done   bool
+	rows        TableRows
+	rowNum      int
+	done        bool
+	columns     map[string][]map[string]string // column definitions keyed by table compare_name
+	constraints map[string][]map[string]string // constraint definitions keyed by table compare_name
 }
 
 // get returns the value from the current row for the given key
@@ -105,18 +210,132 @@ func (c *TableSchema) Compare(obj interface{}) int {
 	return val
 }
 
-// Add returns SQL to add the table or view
+// Add returns SQL to create the table, including its columns and constraints
 func (c TableSchema) Add() {
+	// Partitions are created (or attached) by the PARTITION schema type
+	if c.get("is_partition") == "true" {
+		return
+	}
+
 	schema := DbInfo2.DbSchema
 	if schema == "*" {
 		schema = c.get("table_schema")
 	}
-	fmt.Printf("CREATE %s %s.%s();", c.get("table_type"), schema, c.get("table_name"))
-	fmt.Println()
+
+	// Each column and (primary key, unique, check) constraint is one line of the table definition
+	var lines []string
+	for _, col := range c.columns[c.get("compare_name")] {
+		line := fmt.Sprintf("    %s %s", col["column_name"], col["data_type"])
+		if col["collation"] != "null" {
+			line += " COLLATE " + col["collation"]
+		}
+		if col["column_default"] != "null" {
+			// A generated column keeps its generation expression where other columns keep their default
+			switch col["generated"] {
+			case "s":
+				line += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", col["column_default"])
+			case "v":
+				line += fmt.Sprintf(" GENERATED ALWAYS AS (%s) VIRTUAL", col["column_default"])
+			default:
+				line += " DEFAULT " + col["column_default"]
+			}
+		}
+		if col["not_null"] == "true" {
+			line += " NOT NULL"
+		}
+		if col["identity_generation"] != "null" {
+			line += fmt.Sprintf(" GENERATED %s AS IDENTITY", col["identity_generation"])
+		}
+		lines = append(lines, line)
+	}
+	for _, con := range c.constraints[c.get("compare_name")] {
+		lines = append(lines, fmt.Sprintf("    CONSTRAINT %s %s", con["constraint_name"], con["constraint_def"]))
+	}
+
+	statement := fmt.Sprintf("CREATE %s %s.%s (", c.get("table_type"), schema, c.get("table_name"))
+	if len(lines) > 0 {
+		statement += fmt.Sprintf("\n%s\n", strings.Join(lines, ",\n"))
+	}
+	statement += ")"
+	parents := c.parents()
+	if len(parents) > 0 {
+		statement += fmt.Sprintf(" INHERITS (%s)", strings.Join(parents, ", "))
+	}
+	if c.get("partition_key") != "null" {
+		statement += fmt.Sprintf(" PARTITION BY %s", c.get("partition_key"))
+	}
+	if c.get("reloptions") != "null" {
+		statement += fmt.Sprintf(" WITH (%s)", c.get("reloptions"))
+	}
+	if c.get("tablespace") != "null" {
+		statement += fmt.Sprintf(" TABLESPACE %s", c.get("tablespace"))
+	}
+	statement += ";"
+
+	// The tables it inherits from may not have been created yet
+	if len(parents) > 0 {
+		inheritingTables = append(inheritingTables, inheritingTable{name: schema + "." + c.get("table_name"), parents: parents, statement: statement})
+		return
+	}
+	fmt.Println(statement)
+}
+
+// parents returns the tables that the current (db1) table inherits from, qualified with the
+// schema they are in in db2
+func (c *TableSchema) parents() []string {
+	parents := []string{}
+	if c.get("inherits") == "null" {
+		return parents
+	}
+	for _, parent := range strings.Split(c.get("inherits"), "\n") {
+		if DbInfo1.DbSchema != DbInfo2.DbSchema && strings.HasPrefix(parent, DbInfo1.DbSchema+".") {
+			parent = DbInfo2.DbSchema + "." + strings.TrimPrefix(parent, DbInfo1.DbSchema+".")
+		}
+		parents = append(parents, parent)
+	}
+	return parents
+}
+
+// printInheritingTables prints the CREATE TABLE statements held in inheritingTables, each one
+// after the ones for the tables it inherits from
+func printInheritingTables() {
+	pending := inheritingTables
+	for len(pending) > 0 {
+		waiting := make(map[string]bool)
+		for _, table := range pending {
+			waiting[table.name] = true
+		}
+		next := []inheritingTable{}
+		for _, table := range pending {
+			ready := true
+			for _, parent := range table.parents {
+				if waiting[parent] {
+					ready = false
+				}
+			}
+			if ready {
+				fmt.Println(table.statement)
+			} else {
+				next = append(next, table)
+			}
+		}
+		if len(next) == len(pending) {
+			// Inheritance cannot be circular, but do not loop forever
+			for _, table := range next {
+				fmt.Println(table.statement)
+			}
+			break
+		}
+		pending = next
+	}
 }
 
 // Drop returns SQL to drop the table or view
 func (c TableSchema) Drop() {
+	// Partitions are detached (or dropped) by the PARTITION schema type
+	if c.get("is_partition") == "true" {
+		return
+	}
 	fmt.Printf("DROP %s %s.%s;\n", c.get("table_type"), c.get("table_schema"), c.get("table_name"))
 }
 
@@ -153,10 +372,47 @@ func CompareTables(conn1 *sql.DB, conn2 *sql.DB) {
 	}
 	sort.Sort(rows2)
 
+	// Only db1 tables are ever created, so only db1 needs the table definitions
+	columns := groupRowsByCompareName(conn1, tableColumnDefSqlTemplate, DbInfo1)
+	constraints := groupRowsByCompareName(conn1, tableConstraintSqlTemplate, DbInfo1)
+
 	// We have to explicitly type this as Schema here
-	var schema1 Schema = &TableSchema{rows: rows1, rowNum: -1}
+	var schema1 Schema = &TableSchema{rows: rows1, rowNum: -1, columns: columns, constraints: constraints}
 	var schema2 Schema = &TableSchema{rows: rows2, rowNum: -1}
 
 	// Compare the tables
+	inheritingTables = nil
 	DoDiff(schema1, schema2)
+	printInheritingTables()
+}
+
+// groupRowsByCompareName runs the given template against one database and groups the
+// resulting rows by compare_name, keeping the order they were returned in
+func groupRowsByCompareName(conn *sql.DB, tpl *template.Template, dbInfo pgutil.DbInfo) map[string][]map[string]string {
+	buf := new(bytes.Buffer)
+	tpl.Execute(buf, dbInfo)
+
+	rowChan, _ := pgutil.QueryStrings(conn, buf.String())
+
+	groups := make(map[string][]map[string]string)
+	for row := range rowChan {
+		groups[row["compare_name"]] = append(groups[row["compare_name"]], row)
+	}
+	return groups
+}
+
+// loadDb2Tables reads the tables that db2 has, for isCreatedTable
+func loadDb2Tables(conn2 *sql.DB) {
+	db2Tables = groupRowsByCompareName(conn2, tableSqlTemplate, DbInfo2)
+}
+
+// isCreatedTable tells you whether the given db1 table is missing in db2, so that it is created
+// in full (with its columns and constraints) by TableSchema.Add or PartitionSchema.Add
+func isCreatedTable(schema string, table string) bool {
+	compareName := table
+	if DbInfo2.DbSchema == "*" {
+		compareName = schema + "." + table
+	}
+	_, ok := db2Tables[compareName]
+	return !ok
 }
@@ -27,13 +27,23 @@ func initTriggerSqlTemplate() *template.Template {
     SELECT n.nspname AS schema_name
        , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname || '.' || t.tgname AS compare_name
        , c.relname AS table_name
+       , c.relkind AS table_kind
        , t.tgname AS trigger_name
        , pg_catalog.pg_get_triggerdef(t.oid, true) AS trigger_def
        , t.tgenabled AS enabled
+       , rn.nspname AS referenced_schema
+       , rc.relname AS referenced_table
     FROM pg_catalog.pg_trigger t
     INNER JOIN pg_catalog.pg_class c ON (c.oid = t.tgrelid)
     INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+    LEFT OUTER JOIN pg_catalog.pg_class rc ON (rc.oid = t.tgconstrrelid) -- the FROM table of a constraint trigger
+    LEFT OUTER JOIN pg_catalog.pg_namespace rn ON (rn.oid = rc.relnamespace)
 	WHERE not t.tgisinternal
+    -- triggers on partitions are cloned from the trigger on the partitioned table
+    AND NOT (c.relispartition AND EXISTS (SELECT 1 FROM pg_catalog.pg_inherits i
+                                          INNER JOIN pg_catalog.pg_trigger pt ON (pt.tgrelid = i.inhparent AND pt.tgname = t.tgname)
+                                          WHERE i.inhrelid = c.oid))
+    AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
     {{if eq $.DbSchema "*" }}
     AND n.nspname NOT LIKE 'pg_%' 
     AND n.nspname <> 'information_schema' 
@@ -104,56 +114,103 @@ func (c *TriggerSchema) Compare(obj interface{}) int {
 	return val
 }
 
-// Add returns SQL to create the trigger
-func (c TriggerSchema) Add() {
-	// If we are comparing two different schemas against each other, we need to do some
-	// modification of the first trigger definition so we create it in the right schema
+// definitionForSchema returns the trigger definition, modified (if we are comparing two different
+// schemas against each other) so that it creates the trigger in the right schema
+func (c TriggerSchema) definitionForSchema() string {
 	triggerDef := c.get("trigger_def")
-	schemaName := c.get("schema_name")
 	if DbInfo1.DbSchema != DbInfo2.DbSchema {
-		schemaName = DbInfo2.DbSchema
 		triggerDef = strings.Replace(
 			triggerDef,
 			fmt.Sprintf(" %s.%s ", c.get("schema_name"), c.get("table_name")),
-			fmt.Sprintf(" %s.%s ", schemaName, c.get("table_name")),
+			fmt.Sprintf(" %s.%s ", DbInfo2.DbSchema, c.get("table_name")),
 			-1)
+		// The FROM table of a constraint trigger
+		if c.get("referenced_schema") == c.get("schema_name") {
+			triggerDef = strings.Replace(
+				triggerDef,
+				fmt.Sprintf(" FROM %s.%s ", c.get("referenced_schema"), c.get("referenced_table")),
+				fmt.Sprintf(" FROM %s.%s ", DbInfo2.DbSchema, c.get("referenced_table")),
+				-1)
+		}
+	}
+	return triggerDef
+}
+
+// setEnabled prints SQL that gives the trigger (on the given table) the enabled state of this one
+func (c TriggerSchema) setEnabled(table string) {
+	// Triggers on views are always enabled
+	if c.get("table_kind") == "v" {
+		return
+	}
+	enable := ""
+	switch c.get("enabled") {
+	case "O":
+		enable = "ENABLE"
+	case "D":
+		enable = "DISABLE"
+	case "R":
+		enable = "ENABLE REPLICA"
+	case "A":
+		enable = "ENABLE ALWAYS"
+	default:
+		return
+	}
+	fmt.Printf("ALTER TABLE %s %s TRIGGER %s;\n", table, enable, c.get("trigger_name"))
+}
+
+// Add returns SQL to create the trigger
+func (c TriggerSchema) Add() {
+	schemaName := c.get("schema_name")
+	if DbInfo1.DbSchema != DbInfo2.DbSchema {
+		schemaName = DbInfo2.DbSchema
 	}
 
-	fmt.Printf("%s;\n", triggerDef)
+	fmt.Printf("%s;\n", c.definitionForSchema())
+	if c.get("enabled") != "O" {
+		c.setEnabled(schemaName + "." + c.get("table_name"))
+	}
 }
 
 // Drop returns SQL to drop the trigger
 func (c TriggerSchema) Drop() {
+	// The trigger was dropped along with its view (in VIEW)
+	if c.get("table_kind") == "v" && recreatedViews[c.get("schema_name")+"."+c.get("table_name")] {
+		return
+	}
 	fmt.Printf("DROP TRIGGER %s ON %s.%s;\n", c.get("trigger_name"), c.get("schema_name"), c.get("table_name"))
 }
 
-// Change handles the case where the trigger names match, but the definition does not
+// Change handles the case where the trigger names match, but the definition or enabled state does not
 func (c TriggerSchema) Change(obj interface{}) {
 	c2, ok := obj.(*TriggerSchema)
 	if !ok {
 		fmt.Println("Error!!!, Change needs a TriggerSchema instance", c2)
 	}
-	if c.get("trigger_def") != c2.get("trigger_def") {
-		fmt.Println("-- This function looks different so we'll drop and recreate it:")
 
-		// If we are comparing two different schemas against each other, we need to do some
-		// modification of the first trigger definition so we create it in the right schema
-		triggerDef := c.get("trigger_def")
-		schemaName := c.get("schema_name")
-		if DbInfo1.DbSchema != DbInfo2.DbSchema {
-			schemaName = DbInfo2.DbSchema
-			triggerDef = strings.Replace(
-				triggerDef,
-				fmt.Sprintf(" %s.%s ", c.get("schema_name"), c.get("table_name")),
-				fmt.Sprintf(" %s.%s ", schemaName, c.get("table_name")),
-				-1)
-		}
+	table := c2.get("schema_name") + "." + c2.get("table_name")
+
+	// Recreating a view (in VIEW) drops its triggers
+	if c2.get("table_kind") == "v" && recreatedViews[table] {
+		fmt.Printf("%s;\n", c.definitionForSchema())
+		return
+	}
+
+	if c.definitionForSchema() != c2.get("trigger_def") {
+		fmt.Println("-- This function looks different so we'll drop and recreate it:")
 
 		// The trigger_def column has everything needed to rebuild the function
-		fmt.Printf("DROP TRIGGER %s ON %s.%s;\n", c.get("trigger_name"), schemaName, c.get("table_name"))
+		fmt.Printf("DROP TRIGGER %s ON %s;\n", c.get("trigger_name"), table)
 		fmt.Println("-- STATEMENT-BEGIN")
-		fmt.Printf("%s;\n", triggerDef)
+		fmt.Printf("%s;\n", c.definitionForSchema())
 		fmt.Println("-- STATEMENT-END")
+		if c.get("enabled") != "O" {
+			c.setEnabled(table)
+		}
+		return
+	}
+
+	if c.get("enabled") != c2.get("enabled") {
+		c.setEnabled(table)
 	}
 }
 
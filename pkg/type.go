@@ -0,0 +1,415 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	typeSqlTemplate     = initTypeSqlTemplate()
+	typePartSqlTemplate = initTypePartSqlTemplate()
+)
+
+// Initializes the Sql template
+func initTypeSqlTemplate() *template.Template {
+	sql := `
+SELECT n.nspname AS schema_name
+    , {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}t.typname AS compare_name
+    , t.typname AS type_name
+    , t.typtype AS type_kind
+    , CASE WHEN t.typtype = 'd' THEN pg_catalog.format_type(t.typbasetype, t.typtypmod) END AS base_type
+    , t.typnotnull AS not_null
+    , t.typdefault AS type_default
+    , CASE WHEN t.typtype = 'r' THEN 'SUBTYPE = ' || pg_catalog.format_type(r.rngsubtype, NULL)
+        || CASE WHEN NOT opc.opcdefault THEN ', SUBTYPE_OPCLASS = ' || opc.opcname ELSE '' END
+        || CASE WHEN r.rngcanonical::oid <> 0 THEN ', CANONICAL = ' || r.rngcanonical::text ELSE '' END
+        || CASE WHEN r.rngsubdiff::oid <> 0 THEN ', SUBTYPE_DIFF = ' || r.rngsubdiff::text ELSE '' END
+      END AS range_def
+FROM pg_catalog.pg_type t
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = t.typnamespace)
+LEFT OUTER JOIN pg_catalog.pg_class c ON (c.oid = t.typrelid)
+LEFT OUTER JOIN pg_catalog.pg_range r ON (r.rngtypid = t.oid)
+LEFT OUTER JOIN pg_catalog.pg_opclass opc ON (opc.oid = r.rngsubopc)
+WHERE (t.typtype IN ('e', 'd', 'r') OR (t.typtype = 'c' AND c.relkind = 'c'))
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_type'::regclass AND d.objid = t.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name;
+`
+	t := template.New("TypeSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// Initializes the Sql template for the parts of each type: enum labels, composite
+// attributes, and domain check constraints
+func initTypePartSqlTemplate() *template.Template {
+	sql := `
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}t.typname AS compare_name
+    , e.enumlabel AS part_name
+    , NULL::text AS part_def
+    , e.enumsortorder::float8 AS part_order
+FROM pg_catalog.pg_enum e
+INNER JOIN pg_catalog.pg_type t ON (t.oid = e.enumtypid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = t.typnamespace)
+WHERE true
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+UNION ALL
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}t.typname AS compare_name
+    , a.attname AS part_name
+    , pg_catalog.format_type(a.atttypid, a.atttypmod) AS part_def
+    , a.attnum::float8 AS part_order
+FROM pg_catalog.pg_attribute a
+INNER JOIN pg_catalog.pg_class c ON (c.oid = a.attrelid AND c.relkind = 'c')
+INNER JOIN pg_catalog.pg_type t ON (t.typrelid = c.oid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = t.typnamespace)
+WHERE a.attnum > 0
+AND NOT a.attisdropped
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+UNION ALL
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}t.typname AS compare_name
+    , con.conname AS part_name
+    , pg_catalog.pg_get_constraintdef(con.oid, true) AS part_def
+    , 0::float8 AS part_order
+FROM pg_catalog.pg_constraint con
+INNER JOIN pg_catalog.pg_type t ON (t.oid = con.contypid)
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = t.typnamespace)
+WHERE con.contype = 'c'
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name, part_order, part_name;
+`
+	t := template.New("TypePartSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// TypeRows definition
+// ==================================
+
+// TypeRows is a sortable slice of string maps
+type TypeRows []map[string]string
+
+func (slice TypeRows) Len() int {
+	return len(slice)
+}
+
+func (slice TypeRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice TypeRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// TypeSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+//
+// TypeSchema implements the Schema interface defined in pgdiff.go
+type TypeSchema struct {
+	rows   TypeRows
+	rowNum int
+	done   bool
+	parts  map[string][]map[string]string // enum labels, attributes, and domain constraints keyed by compare_name
+}
+
+// get returns the value from the current row for the given key
+func (c *TypeSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// getParts returns the enum labels, composite attributes, or domain constraints of the current row
+func (c *TypeSchema) getParts() []map[string]string {
+	return c.parts[c.get("compare_name")]
+}
+
+// getPartNames returns the names of the parts of the current row, in order
+func (c *TypeSchema) getPartNames() []string {
+	names := make([]string, 0)
+	for _, part := range c.getParts() {
+		names = append(names, part["part_name"])
+	}
+	return names
+}
+
+// getPartDef returns the definition of the named part of the current row, or an empty string
+func (c *TypeSchema) getPartDef(name string) string {
+	for _, part := range c.getParts() {
+		if part["part_name"] == name {
+			return part["part_def"]
+		}
+	}
+	return ""
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *TypeSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *TypeSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*TypeSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a TypeSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// Add returns SQL to create the type or domain
+func (c *TypeSchema) Add() {
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+
+	switch c.get("type_kind") {
+	case "e":
+		labels := make([]string, 0)
+		for _, label := range c.getPartNames() {
+			labels = append(labels, quoteLiteral(label))
+		}
+		fmt.Printf("CREATE TYPE %s.%s AS ENUM (%s);\n", schema, c.get("type_name"), strings.Join(labels, ", "))
+	case "c":
+		attributes := make([]string, 0)
+		for _, part := range c.getParts() {
+			attributes = append(attributes, part["part_name"]+" "+part["part_def"])
+		}
+		fmt.Printf("CREATE TYPE %s.%s AS (%s);\n", schema, c.get("type_name"), strings.Join(attributes, ", "))
+	case "d":
+		domainDef := c.get("base_type")
+		if c.get("type_default") != "null" {
+			domainDef += " DEFAULT " + c.get("type_default")
+		}
+		if c.get("not_null") == "true" {
+			domainDef += " NOT NULL"
+		}
+		for _, part := range c.getParts() {
+			domainDef += fmt.Sprintf(" CONSTRAINT %s %s", part["part_name"], part["part_def"])
+		}
+		fmt.Printf("CREATE DOMAIN %s.%s AS %s;\n", schema, c.get("type_name"), domainDef)
+	case "r":
+		fmt.Printf("CREATE TYPE %s.%s AS RANGE (%s);\n", schema, c.get("type_name"), c.get("range_def"))
+	default:
+		fmt.Printf("-- Unexpected type kind %s for %s.%s\n", c.get("type_kind"), schema, c.get("type_name"))
+	}
+}
+
+// Drop returns SQL to drop the type or domain
+func (c *TypeSchema) Drop() {
+	kind := "TYPE"
+	if c.get("type_kind") == "d" {
+		kind = "DOMAIN"
+	}
+	fmt.Printf("-- Note that this will fail if any column or function still uses %s.%s\n", c.get("schema_name"), c.get("type_name"))
+	fmt.Printf("DROP %s %s.%s;\n", kind, c.get("schema_name"), c.get("type_name"))
+}
+
+// Change handles the case where the type names match, but the definition does not
+func (c *TypeSchema) Change(obj interface{}) {
+	c2, ok := obj.(*TypeSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a TypeSchema instance", c2)
+	}
+
+	// A type cannot be changed into another kind of type
+	if c.get("type_kind") != c2.get("type_kind") {
+		fmt.Printf("-- WARNING: %s.%s is a different kind of type in each db, so we'll drop and recreate it:\n", c2.get("schema_name"), c.get("type_name"))
+		c2.Drop()
+		c.Add()
+		return
+	}
+
+	switch c.get("type_kind") {
+	case "e":
+		c.changeEnum(c2)
+	case "c":
+		c.changeComposite(c2)
+	case "d":
+		c.changeDomain(c2)
+	case "r":
+		if c.get("range_def") != c2.get("range_def") {
+			fmt.Printf("-- WARNING: range types cannot be altered, so we'll drop and recreate %s.%s:\n", c2.get("schema_name"), c.get("type_name"))
+			c2.Drop()
+			c.Add()
+		}
+	}
+}
+
+// changeEnum adds the labels that db2 is missing, each positioned next to a label it already has
+func (c *TypeSchema) changeEnum(c2 *TypeSchema) {
+	labels1 := c.getPartNames()
+	labels2 := c2.getPartNames()
+
+	for i, label := range labels1 {
+		if pgutil.ContainsString(labels2, label) {
+			continue
+		}
+		position := ""
+		if i > 0 {
+			// The previous label is in db2 by now, whether it was already there or just added
+			position = " AFTER " + quoteLiteral(labels1[i-1])
+		} else {
+			for _, next := range labels1[1:] {
+				if pgutil.ContainsString(labels2, next) {
+					position = " BEFORE " + quoteLiteral(next)
+					break
+				}
+			}
+		}
+		fmt.Printf("ALTER TYPE %s.%s ADD VALUE %s%s;\n", c2.get("schema_name"), c.get("type_name"), quoteLiteral(label), position)
+	}
+
+	// Enum labels can be added, but never removed or reordered
+	for _, label := range labels2 {
+		if !pgutil.ContainsString(labels1, label) {
+			fmt.Printf("-- WARNING: enum %s.%s has a value that db1 does not: %s.  It can only be removed by recreating the type.\n", c2.get("schema_name"), c.get("type_name"), label)
+		}
+	}
+}
+
+// changeComposite adds, drops, and alters attributes so the composite types match
+func (c *TypeSchema) changeComposite(c2 *TypeSchema) {
+	names1 := c.getPartNames()
+	names2 := c2.getPartNames()
+
+	for _, name := range names2 {
+		if !pgutil.ContainsString(names1, name) {
+			fmt.Printf("ALTER TYPE %s.%s DROP ATTRIBUTE %s;\n", c2.get("schema_name"), c.get("type_name"), name)
+		}
+	}
+	for _, name := range names1 {
+		if !pgutil.ContainsString(names2, name) {
+			fmt.Printf("ALTER TYPE %s.%s ADD ATTRIBUTE %s %s;\n", c2.get("schema_name"), c.get("type_name"), name, c.getPartDef(name))
+		} else if c.getPartDef(name) != c2.getPartDef(name) {
+			fmt.Printf("ALTER TYPE %s.%s ALTER ATTRIBUTE %s TYPE %s;\n", c2.get("schema_name"), c.get("type_name"), name, c.getPartDef(name))
+		}
+	}
+}
+
+// changeDomain alters the default, not null, and check constraints so the domains match
+func (c *TypeSchema) changeDomain(c2 *TypeSchema) {
+	// The base type of a domain cannot be altered
+	if c.get("base_type") != c2.get("base_type") {
+		fmt.Printf("-- WARNING: the base type of domain %s.%s is different (%s to %s), so we'll drop and recreate it:\n", c2.get("schema_name"), c.get("type_name"), c2.get("base_type"), c.get("base_type"))
+		c2.Drop()
+		c.Add()
+		return
+	}
+
+	domain := c2.get("schema_name") + "." + c.get("type_name")
+
+	if c.get("type_default") != c2.get("type_default") {
+		if c.get("type_default") == "null" {
+			fmt.Printf("ALTER DOMAIN %s DROP DEFAULT;\n", domain)
+		} else {
+			fmt.Printf("ALTER DOMAIN %s SET DEFAULT %s;\n", domain, c.get("type_default"))
+		}
+	}
+
+	if c.get("not_null") != c2.get("not_null") {
+		if c.get("not_null") == "true" {
+			fmt.Printf("ALTER DOMAIN %s SET NOT NULL;\n", domain)
+		} else {
+			fmt.Printf("ALTER DOMAIN %s DROP NOT NULL;\n", domain)
+		}
+	}
+
+	names1 := c.getPartNames()
+	names2 := c2.getPartNames()
+	for _, name := range names2 {
+		if !pgutil.ContainsString(names1, name) || c.getPartDef(name) != c2.getPartDef(name) {
+			fmt.Printf("ALTER DOMAIN %s DROP CONSTRAINT %s; -- %s\n", domain, name, c2.getPartDef(name))
+		}
+	}
+	for _, name := range names1 {
+		if !pgutil.ContainsString(names2, name) || c.getPartDef(name) != c2.getPartDef(name) {
+			fmt.Printf("ALTER DOMAIN %s ADD CONSTRAINT %s %s;\n", domain, name, c.getPartDef(name))
+		}
+	}
+}
+
+// quoteLiteral returns the given string as a single-quoted SQL literal
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// ==================================
+// Functions
+// ==================================
+
+// CompareTypes outputs SQL to make the user-defined types (enums, composites, domains, and ranges) match between DBs
+func CompareTypes(conn1 *sql.DB, conn2 *sql.DB) {
+
+	buf1 := new(bytes.Buffer)
+	typeSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	typeSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(TypeRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(TypeRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	parts1 := groupRowsByCompareName(conn1, typePartSqlTemplate, DbInfo1)
+	parts2 := groupRowsByCompareName(conn2, typePartSqlTemplate, DbInfo2)
+
+	// We must explicitly type this as Schema here
+	var schema1 Schema = &TypeSchema{rows: rows1, rowNum: -1, parts: parts1}
+	var schema2 Schema = &TypeSchema{rows: rows2, rowNum: -1, parts: parts2}
+
+	// Compare the types
+	DoDiff(schema1, schema2)
+}
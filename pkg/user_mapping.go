@@ -0,0 +1,193 @@
+//
+// Copyright (c) 2017 Jon Carlson.  All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+//
+
+package pkg
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiapeish/pgdiff/pgutil"
+)
+
+var (
+	userMappingSqlTemplate = initUserMappingSqlTemplate()
+)
+
+// Initializes the Sql template
+//
+// The password option is never selected.  has_password only tells whether a mapping has one,
+// so passwords are redacted and never compared.  umoptions is null when the connected user
+// is not allowed to see the options of a mapping, which hidden_options tells apart from a
+// mapping without options.
+func initUserMappingSqlTemplate() *template.Template {
+	sql := `
+SELECT m.srvname || '.' || m.usename AS compare_name
+    , m.srvname AS server_name
+    , m.usename AS user_name
+    , array_to_string(ARRAY(SELECT o FROM unnest(m.umoptions) AS o WHERE o NOT LIKE 'password=%' ORDER BY o), E'\n') AS options
+    , EXISTS (SELECT 1 FROM unnest(m.umoptions) AS o WHERE o LIKE 'password=%') AS has_password
+    , m.umoptions IS NULL AS hidden_options
+FROM pg_catalog.pg_user_mappings m
+ORDER BY compare_name;
+`
+	t := template.New("UserMappingSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
+// ==================================
+// UserMappingRows definition
+// ==================================
+
+// UserMappingRows is a sortable slice of string maps
+type UserMappingRows []map[string]string
+
+func (slice UserMappingRows) Len() int {
+	return len(slice)
+}
+
+func (slice UserMappingRows) Less(i, j int) bool {
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
+}
+
+func (slice UserMappingRows) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// UserMappingSchema holds a slice of rows from one of the databases as well as
+// a reference to the current row of data we're viewing.
+//
+// UserMappingSchema implements the Schema interface defined in pgdiff.go
+type UserMappingSchema struct {
+	rows   UserMappingRows
+	rowNum int
+	done   bool
+}
+
+// get returns the value from the current row for the given key
+func (c *UserMappingSchema) get(key string) string {
+	if c.rowNum >= len(c.rows) {
+		return ""
+	}
+	return c.rows[c.rowNum][key]
+}
+
+// NextRow increments the rowNum and tells you whether or not there are more
+func (c *UserMappingSchema) NextRow() bool {
+	if c.rowNum >= len(c.rows)-1 {
+		c.done = true
+	}
+	c.rowNum = c.rowNum + 1
+	return !c.done
+}
+
+// Compare tells you, in one pass, whether or not the first row matches, is less than, or greater than the second row
+func (c *UserMappingSchema) Compare(obj interface{}) int {
+	c2, ok := obj.(*UserMappingSchema)
+	if !ok {
+		fmt.Println("Error!!!, Compare(obj) needs a UserMappingSchema instance", c2)
+		return +999
+	}
+
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	return val
+}
+
+// target returns the user and server that identify the user mapping
+func (c *UserMappingSchema) target() string {
+	return fmt.Sprintf("FOR %s SERVER %s", c.get("user_name"), c.get("server_name"))
+}
+
+// passwordNotice prints a notice that the password of the user mapping has to be set by hand
+func (c *UserMappingSchema) passwordNotice() {
+	fmt.Printf("-- Notice!, the password of user mapping %s is redacted.  Set it with: ALTER USER MAPPING %s OPTIONS (ADD password '...');\n", c.target(), c.target())
+}
+
+// Add returns SQL to create the user mapping
+func (c UserMappingSchema) Add() {
+	if c.get("hidden_options") == "true" {
+		fmt.Printf("-- Notice!, the options of user mapping %s cannot be read in db1, so it is created without them.\n", c.target())
+	}
+	fmt.Printf("CREATE USER MAPPING %s%s;\n", c.target(), optionsClause(parseConfig(c.get("options"))))
+	if c.get("has_password") == "true" {
+		c.passwordNotice()
+	}
+}
+
+// Drop returns SQL to drop the user mapping
+func (c UserMappingSchema) Drop() {
+	fmt.Printf("DROP USER MAPPING %s;\n", c.target())
+}
+
+// Change handles the case where the user and server match, but the options do not
+func (c UserMappingSchema) Change(obj interface{}) {
+	c2, ok := obj.(*UserMappingSchema)
+	if !ok {
+		fmt.Println("Error!!!, Change needs a UserMappingSchema instance", c2)
+	}
+
+	// Options that cannot be read cannot be compared
+	if c.get("hidden_options") == "true" || c2.get("hidden_options") == "true" {
+		fmt.Printf("-- Notice!, the options of user mapping %s cannot be read in both databases, so they are not compared.  Connect as a superuser or as the owner of the server.\n", c2.target())
+		return
+	}
+
+	actions := optionChanges(parseConfig(c.get("options")), parseConfig(c2.get("options")))
+
+	// Only whether there is a password is compared, never the password itself
+	if c.get("has_password") == "false" && c2.get("has_password") == "true" {
+		actions = append(actions, "DROP password")
+	}
+	if len(actions) > 0 {
+		fmt.Printf("ALTER USER MAPPING %s OPTIONS (%s);\n", c2.target(), strings.Join(actions, ", "))
+	}
+	if c.get("has_password") == "true" && c2.get("has_password") == "false" {
+		c2.passwordNotice()
+	}
+}
+
+// CompareUserMappings outputs SQL to make the user mappings match between DBs
+func CompareUserMappings(conn1 *sql.DB, conn2 *sql.DB) {
+
+	// User mappings belong to the database, so there is nothing to compare
+	// between two schemas of the same database.
+	if DbInfo1.DbSchema != DbInfo2.DbSchema {
+		return
+	}
+
+	buf1 := new(bytes.Buffer)
+	userMappingSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	userMappingSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
+
+	rows1 := make(UserMappingRows, 0)
+	for row := range rowChan1 {
+		rows1 = append(rows1, row)
+	}
+	sort.Sort(rows1)
+
+	rows2 := make(UserMappingRows, 0)
+	for row := range rowChan2 {
+		rows2 = append(rows2, row)
+	}
+	sort.Sort(rows2)
+
+	// We have to explicitly type this as Schema here
+	var schema1 Schema = &UserMappingSchema{rows: rows1, rowNum: -1}
+	var schema2 Schema = &UserMappingSchema{rows: rows2, rowNum: -1}
+
+	// Compare the user mappings
+	DoDiff(schema1, schema2)
+}
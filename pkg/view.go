@@ -7,13 +7,110 @@
 package pkg
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
+	"text/template"
 
 	"github.com/jiapeish/pgdiff/pgutil"
 )
 
+var (
+	viewSqlTemplate = initViewSqlTemplate()
+)
+
+// recreatedViews holds the (db2) schema-qualified names of the views that were dropped and
+// recreated from db1 by ViewSchema.Change, so their triggers are gone too
+var recreatedViews = make(map[string]bool)
+
+// droppedViews holds the (db2) schema-qualified names of the views that ViewSchema.Drop dropped
+var droppedViews = make(map[string]bool)
+
+// viewDependentsColumnSql selects the dependents of the view (or matview) c.  It is a JSON array with
+// one object per view or matview that depends on it (directly or not), ordered by the longest chain
+// of views between the two.  Each object has the columns that recreating it takes, as text.
+const viewDependentsColumnSql = `    , (WITH RECURSIVE deps (oid, depth) AS (
+            SELECT r.ev_class, 1
+            FROM pg_catalog.pg_depend d
+            INNER JOIN pg_catalog.pg_rewrite r ON (r.oid = d.objid)
+            WHERE d.classid = 'pg_rewrite'::regclass AND d.refclassid = 'pg_class'::regclass
+            AND d.refobjid = c.oid AND r.ev_class <> c.oid
+          UNION ALL
+            SELECT r.ev_class, deps.depth + 1
+            FROM deps
+            INNER JOIN pg_catalog.pg_depend d ON (d.classid = 'pg_rewrite'::regclass AND d.refclassid = 'pg_class'::regclass AND d.refobjid = deps.oid)
+            INNER JOIN pg_catalog.pg_rewrite r ON (r.oid = d.objid)
+            WHERE r.ev_class <> deps.oid AND deps.depth < 100
+       )
+       SELECT json_agg(json_build_object(
+                'relkind', dc.relkind
+                , 'schema_name', dn.nspname
+                , 'view_name', dc.relname
+                , 'matview_name', dc.relname
+                , 'definition', pg_catalog.pg_get_viewdef(dc.oid, true)
+                , 'options', COALESCE(array_to_string(dc.reloptions, ', '), 'null')
+                , 'storage_options', COALESCE(array_to_string(dc.reloptions, ', '), 'null')
+                , 'populated', dc.relispopulated::text
+                , 'tablespace', COALESCE(dts.spcname::text, 'null')
+                , 'owner', pg_catalog.pg_get_userbyid(dc.relowner)
+                , 'description', COALESCE(pg_catalog.obj_description(dc.oid, 'pg_class'), 'null')
+                , 'grants', COALESCE((SELECT string_agg(acl.privilege_type || ' TO ' || CASE WHEN acl.grantee = 0 THEN 'PUBLIC' ELSE quote_ident(pg_catalog.pg_get_userbyid(acl.grantee)) END
+                                         || CASE WHEN acl.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END, E'\n' ORDER BY acl.grantee, acl.privilege_type)
+                       FROM aclexplode(dc.relacl) AS acl
+                       WHERE acl.grantee <> dc.relowner), 'null')
+                , 'index_defs', COALESCE((SELECT string_agg(pg_catalog.pg_get_indexdef(i.indexrelid), E'\n' ORDER BY ic.relname)
+                       FROM pg_catalog.pg_index i
+                       INNER JOIN pg_catalog.pg_class ic ON (ic.oid = i.indexrelid)
+                       WHERE i.indrelid = dc.oid), 'null')
+                , 'triggers', COALESCE((SELECT string_agg(pg_catalog.pg_get_triggerdef(t.oid), E'\n' ORDER BY t.tgname)
+                       FROM pg_catalog.pg_trigger t
+                       WHERE t.tgrelid = dc.oid AND NOT t.tgisinternal), 'null')
+              ) ORDER BY x.depth, dn.nspname, dc.relname)
+       FROM (SELECT deps.oid, max(deps.depth) AS depth FROM deps GROUP BY deps.oid) AS x
+       INNER JOIN pg_catalog.pg_class dc ON (dc.oid = x.oid)
+       INNER JOIN pg_catalog.pg_namespace dn ON (dn.oid = dc.relnamespace)
+       LEFT OUTER JOIN pg_catalog.pg_tablespace dts ON (dts.oid = dc.reltablespace)) AS dependents
+`
+
+// Initializes the Sql template
+//
+// columns holds one "<name> <type>" per line.  dependents is described at viewDependentsColumnSql.
+func initViewSqlTemplate() *template.Template {
+	sql := `
+SELECT {{if eq $.DbSchema "*" }}n.nspname || '.' || {{end}}c.relname AS compare_name
+    , n.nspname AS schema_name
+    , c.relname AS view_name
+    , pg_catalog.pg_get_viewdef(c.oid, true) AS definition
+    , array_to_string(c.reloptions, ', ') AS options
+    , pg_catalog.pg_get_userbyid(c.relowner) AS owner
+    , pg_catalog.obj_description(c.oid, 'pg_class') AS description
+    , (SELECT string_agg(acl.privilege_type || ' TO ' || CASE WHEN acl.grantee = 0 THEN 'PUBLIC' ELSE quote_ident(pg_catalog.pg_get_userbyid(acl.grantee)) END
+                         || CASE WHEN acl.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END, E'\n' ORDER BY acl.grantee, acl.privilege_type)
+       FROM aclexplode(c.relacl) AS acl
+       WHERE acl.grantee <> c.relowner) AS grants
+    , (SELECT string_agg(a.attname || ' ' || pg_catalog.format_type(a.atttypid, a.atttypmod), E'\n' ORDER BY a.attnum)
+       FROM pg_catalog.pg_attribute a
+       WHERE a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped) AS columns
+` + viewDependentsColumnSql + `FROM pg_catalog.pg_class c
+INNER JOIN pg_catalog.pg_namespace n ON (n.oid = c.relnamespace)
+WHERE c.relkind = 'v'
+AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_depend d WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'e')
+{{if eq $.DbSchema "*" }}
+AND n.nspname NOT LIKE 'pg_%'
+AND n.nspname <> 'information_schema'
+{{else}}
+AND n.nspname = '{{$.DbSchema}}'
+{{end}}
+ORDER BY compare_name;
+`
+	t := template.New("ViewSqlTmpl")
+	template.Must(t.Parse(sql))
+	return t
+}
+
 // ==================================
 // ViewRows definition
 // ==================================
@@ -26,7 +123,7 @@ func (slice ViewRows) Len() int {
 }
 
 func (slice ViewRows) Less(i, j int) bool {
-	return slice[i]["viewname"] < slice[j]["viewname"]
+	return slice[i]["compare_name"] < slice[j]["compare_name"]
 }
 
 func (slice ViewRows) Swap(i, j int) {
@@ -41,6 +138,7 @@ type ViewSchema struct {
 	rows   ViewRows
 	rowNum int
 	done   bool
+	byName map[string]map[string]string // all rows keyed by compare_name
 }
 
 // get returns the value from the current row for the given key
@@ -68,49 +166,202 @@ func (c *ViewSchema) Compare(obj interface{}) int {
 		return +999
 	}
 
-	val := pgutil.CompareStrings(c.get("viewname"), c2.get("viewname"))
-	//fmt.Printf("-- Compared %v: %s with %s \n", val, c.get("viewname"), c2.get("viewname"))
+	val := pgutil.CompareStrings(c.get("compare_name"), c2.get("compare_name"))
+	//fmt.Printf("-- Compared %v: %s with %s \n", val, c.get("compare_name"), c2.get("compare_name"))
 	return val
 }
 
+// createView prints SQL to create (or replace) the view in the given row, in the given schema
+func createView(create string, schema string, row map[string]string) {
+	options := ""
+	if row["options"] != "null" {
+		options = fmt.Sprintf(" WITH (%s)", row["options"])
+	}
+	fmt.Printf("%s %s.%s%s AS\n%s\n\n", create, schema, row["view_name"], options, row["definition"])
+}
+
 // Add returns SQL to create the view
 func (c ViewSchema) Add() {
-	fmt.Printf("CREATE VIEW %s AS %s \n\n", c.get("viewname"), c.get("definition"))
+	schema := DbInfo2.DbSchema
+	if schema == "*" {
+		schema = c.get("schema_name")
+	}
+	createView("CREATE VIEW", schema, c.rows[c.rowNum])
 }
 
 // Drop returns SQL to drop the view
 func (c ViewSchema) Drop() {
-	fmt.Printf("DROP VIEW %s;\n\n", c.get("viewname"))
+	if recreatedViews[c.get("schema_name")+"."+c.get("view_name")] {
+		return
+	}
+	fmt.Printf("DROP VIEW %s.%s;\n\n", c.get("schema_name"), c.get("view_name"))
+	droppedViews[c.get("schema_name")+"."+c.get("view_name")] = true
 }
 
-// Change handles the case where the names match, but the definition does not
+// Change handles the case where the names match, but the definition or options do not
 func (c ViewSchema) Change(obj interface{}) {
 	c2, ok := obj.(*ViewSchema)
 	if !ok {
 		fmt.Println("Error!!!, Change needs a ViewSchema instance", c2)
 	}
-	if c.get("definition") != c2.get("definition") {
-		fmt.Printf("DROP VIEW %s;\n", c.get("viewname"))
-		fmt.Printf("CREATE VIEW %s AS %s \n\n", c.get("viewname"), c.get("definition"))
+
+	schema := c2.get("schema_name")
+	if recreatedViews[schema+"."+c2.get("view_name")] {
+		// This view was already recreated along with a view it depends on
+		return
+	}
+
+	if c.get("definition") == c2.get("definition") {
+		if c.get("options") != c2.get("options") {
+			name := schema + "." + c2.get("view_name")
+			options1 := parseStorageOptions(c.get("options"))
+			resets := []string{}
+			for _, option := range sortedKeys(parseStorageOptions(c2.get("options"))) {
+				if _, ok := options1[option]; !ok {
+					resets = append(resets, option)
+				}
+			}
+			if len(resets) > 0 {
+				fmt.Printf("ALTER VIEW %s RESET (%s);\n", name, strings.Join(resets, ", "))
+			}
+			if c.get("options") != "null" {
+				fmt.Printf("ALTER VIEW %s SET (%s);\n", name, c.get("options"))
+			}
+		}
+		return
+	}
+
+	// CREATE OR REPLACE VIEW can change the query, but it can only add columns to the end
+	if c2.get("columns") == c.get("columns") || strings.HasPrefix(c.get("columns"), c2.get("columns")+"\n") {
+		createView("CREATE OR REPLACE VIEW", schema, c.rows[c.rowNum])
+		return
+	}
+
+	fmt.Printf("-- The columns of %s.%s are different so we'll drop and recreate it (and the views that depend on it):\n", schema, c2.get("view_name"))
+	dependents := c2.dependents()
+	dropViewDependents(dependents)
+	fmt.Printf("DROP VIEW %s.%s;\n", schema, c2.get("view_name"))
+	recreateView(schema, c.rows[c.rowNum])
+	recreatedViews[schema+"."+c2.get("view_name")] = true
+	recreateViewDependents(dependents, c.byName)
+}
+
+// dropViewDependents prints SQL to drop the given dependent views (and matviews) from the deepest one up
+func dropViewDependents(dependents []viewDependent) {
+	for i := len(dependents) - 1; i >= 0; i-- {
+		d := dependents[i]
+		if d.relkind == "m" {
+			fmt.Printf("DROP MATERIALIZED VIEW IF EXISTS %s.%s;\n", d.schema, d.name)
+			continue
+		}
+		fmt.Printf("DROP VIEW IF EXISTS %s.%s;\n", d.schema, d.name)
+	}
+}
+
+// recreateViewDependents prints SQL to recreate the given dependent views (and matviews) from the
+// top down, from db1's definition when db1 has the view (in db1Views, keyed by compare_name) and
+// from db2's own definition otherwise
+func recreateViewDependents(dependents []viewDependent, db1Views map[string]map[string]string) {
+	for _, d := range dependents {
+		if droppedViews[d.schema+"."+d.name] {
+			// DoDiff already dropped this view because db1 does not have it
+			continue
+		}
+		if d.relkind == "m" {
+			fmt.Printf("-- Notice!, materialized view %s.%s is recreated from db2's definition.  Run pgdiff with the MATVIEW option afterwards.\n", d.schema, d.name)
+			matView := MatViewSchema{rows: MatViewRows{d.row}, rowNum: 0}
+			matView.create(d.schema)
+			continue
+		}
+		if row, ok := db1Row(db1Views, d); ok {
+			recreateView(d.schema, row)
+			recreatedViews[d.schema+"."+d.name] = true
+			continue
+		}
+		// A view that db1 does not have in the compared schemas is left unmarked, so DoDiff
+		// still drops it when it gets to it
+		fmt.Printf("-- Notice!, %s.%s is recreated from db2's definition because it is not in db1.\n", d.schema, d.name)
+		recreateView(d.schema, d.row)
+		if d.row["triggers"] != "null" {
+			for _, trigger := range strings.Split(d.row["triggers"], "\n") {
+				fmt.Printf("%s;\n", trigger)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+// recreateView prints SQL to create the view in the given row, and to restore its owner, grants and comment
+func recreateView(schema string, row map[string]string) {
+	createView("CREATE VIEW", schema, row)
+	name := schema + "." + row["view_name"]
+	printOwnerAndGrants("VIEW", name, row)
+	if row["description"] != "null" {
+		fmt.Printf("COMMENT ON VIEW %s IS %s;\n", name, quoteLiteral(row["description"]))
+	}
+	fmt.Println()
+}
+
+// viewDependent is a view (or matview) that depends on another view
+type viewDependent struct {
+	relkind string
+	schema  string
+	name    string
+	row     map[string]string // db2's definition, in the form of a view (or matview) row
+}
+
+// parseViewDependents converts the dependents (as selected by viewDependentsColumnSql) of the
+// view or matview with the given name into a slice, in the order they can be created
+func parseViewDependents(name string, dependentsJson string) []viewDependent {
+	dependents := []viewDependent{}
+	if dependentsJson == "null" {
+		return dependents
+	}
+	rows := []map[string]string{}
+	if err := json.Unmarshal([]byte(dependentsJson), &rows); err != nil {
+		fmt.Printf("-- Error!!!, could not read the views that depend on %s: %v\n", name, err)
+		return dependents
+	}
+	for _, row := range rows {
+		dependents = append(dependents, viewDependent{relkind: row["relkind"], schema: row["schema_name"], name: row["view_name"], row: row})
 	}
+	return dependents
+}
+
+// dependents returns the views that depend on the current view, in the order they can be created
+func (c *ViewSchema) dependents() []viewDependent {
+	return parseViewDependents(c.get("schema_name")+"."+c.get("view_name"), c.get("dependents"))
+}
+
+// db1Row finds the db1 row of a (db2) dependent view in db1Views, which is keyed by compare_name
+func db1Row(db1Views map[string]map[string]string, d viewDependent) (map[string]string, bool) {
+	compareName := d.name
+	if DbInfo2.DbSchema == "*" {
+		compareName = d.schema + "." + d.name
+	} else if d.schema != DbInfo2.DbSchema {
+		return nil, false
+	}
+	row, ok := db1Views[compareName]
+	return row, ok
 }
 
 // compareViews outputs SQL to make the views match between DBs
 func CompareViews(conn1 *sql.DB, conn2 *sql.DB) {
-	sql := `
-	SELECT schemaname || '.' || viewname AS viewname
-		, definition 
-	FROM pg_views 
-	WHERE schemaname NOT LIKE 'pg_%' AND schemaname!='infromation_schema'
-	ORDER BY viewname;
-	`
 
-	rowChan1, _ := pgutil.QueryStrings(conn1, sql)
-	rowChan2, _ := pgutil.QueryStrings(conn2, sql)
+	buf1 := new(bytes.Buffer)
+	viewSqlTemplate.Execute(buf1, DbInfo1)
+
+	buf2 := new(bytes.Buffer)
+	viewSqlTemplate.Execute(buf2, DbInfo2)
+
+	rowChan1, _ := pgutil.QueryStrings(conn1, buf1.String())
+	rowChan2, _ := pgutil.QueryStrings(conn2, buf2.String())
 
 	rows1 := make(ViewRows, 0)
+	byName1 := make(map[string]map[string]string)
 	for row := range rowChan1 {
 		rows1 = append(rows1, row)
+		byName1[row["compare_name"]] = row
 	}
 	sort.Sort(rows1)
 
@@ -121,7 +372,7 @@ func CompareViews(conn1 *sql.DB, conn2 *sql.DB) {
 	sort.Sort(rows2)
 
 	// We have to explicitly type this as Schema here
-	var schema1 Schema = &ViewSchema{rows: rows1, rowNum: -1}
+	var schema1 Schema = &ViewSchema{rows: rows1, rowNum: -1, byName: byName1}
 	var schema2 Schema = &ViewSchema{rows: rows2, rowNum: -1}
 
 	// Compare the views